@@ -0,0 +1,67 @@
+package main
+
+import "sort"
+
+// aggregator sums the results of a run into the statistics and the
+// per-platform breakdown. It is fed by the single goroutine draining the
+// results of processor.run, so the workers never share counters and the
+// totals don't depend on the order programs finish in.
+type aggregator struct {
+	stats     Statistics
+	platforms map[string]*PlatformStatistics
+	// apexes are the registered domains with new FQDNs across all programs
+	apexes map[string]bool
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{platforms: make(map[string]*PlatformStatistics), apexes: make(map[string]bool)}
+}
+
+// add counts a successfully processed program
+func (a *aggregator) add(result ProgramResult) {
+	s := &a.stats
+	s.ProcessedPrograms++
+	s.Files += result.FileCount
+	s.FQDNs += result.FQDNCount
+	if result.NewFiles > 0 || result.NewFQDNs > 0 {
+		s.UpdatedPrograms++
+		s.NewFiles += result.NewFiles
+		s.NewFQDNs += result.NewFQDNs
+	}
+	s.ResolvedFQDNs += result.resolvedFQDNs
+	s.FuzzyDuplicates += result.fuzzyDuplicates
+	s.IgnoredWildcards += result.ignoredWildcards
+	s.PrunedFiles += result.prunedFiles
+	if result.empty {
+		s.EmptyPrograms++
+	}
+	// Programs sharing an apex count it once
+	for _, apex := range result.newApexes {
+		a.apexes[apex] = true
+	}
+	s.NewApexes = len(a.apexes)
+
+	p := a.platforms[result.Platform]
+	if p == nil {
+		p = &PlatformStatistics{Platform: result.Platform}
+		a.platforms[result.Platform] = p
+	}
+	p.ProcessedPrograms++
+	p.Files += result.FileCount
+	p.FQDNs += result.FQDNCount
+	if result.NewFiles > 0 || result.NewFQDNs > 0 {
+		p.UpdatedPrograms++
+		p.NewFiles += result.NewFiles
+		p.NewFQDNs += result.NewFQDNs
+	}
+}
+
+// platformStatistics returns the per-platform breakdown ordered by platform
+func (a *aggregator) platformStatistics() []PlatformStatistics {
+	sorted := make([]PlatformStatistics, 0, len(a.platforms))
+	for _, p := range a.platforms {
+		sorted = append(sorted, *p)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Platform < sorted[j].Platform })
+	return sorted
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestAggregatorConcurrentResults(t *testing.T) {
+	setOpts(t, nil)
+	const workers, perWorker = 8, 50
+	platforms := []string{"bugcrowd", "hackerone", "intigriti"}
+
+	// Like processor.run, the workers only send on the channel and the
+	// single consumer adds the results
+	results := make(chan ProgramResult)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				result := ProgramResult{
+					Program:   fmt.Sprintf("p%d-%d", w, i),
+					Platform:  platforms[i%len(platforms)],
+					FileCount: 2,
+					FQDNCount: 10,
+					Success:   true,
+				}
+				if i%2 == 0 {
+					result.NewFiles, result.NewFQDNs = 1, 3
+					result.newApexes = []string{fmt.Sprintf("apex%d.com", i%5)}
+				}
+				results <- result
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	agg := newAggregator()
+	for result := range results {
+		agg.add(result)
+	}
+
+	const programs = workers * perWorker
+	s := agg.stats
+	if s.ProcessedPrograms != programs || s.Files != 2*programs || s.FQDNs != 10*programs {
+		t.Errorf("totals = %d programs, %d files, %d FQDNs", s.ProcessedPrograms, s.Files, s.FQDNs)
+	}
+	if s.UpdatedPrograms != programs/2 || s.NewFiles != programs/2 || s.NewFQDNs != 3*programs/2 {
+		t.Errorf("updates = %d programs, %d files, %d FQDNs", s.UpdatedPrograms, s.NewFiles, s.NewFQDNs)
+	}
+	if s.NewApexes != 5 {
+		t.Errorf("new apexes = %d, want 5", s.NewApexes)
+	}
+
+	byPlatform := agg.platformStatistics()
+	if len(byPlatform) != len(platforms) {
+		t.Fatalf("got %d platforms, want %d", len(byPlatform), len(platforms))
+	}
+	sum := 0
+	for i, p := range byPlatform {
+		if p.Platform != platforms[i] {
+			t.Errorf("platform %d = %s, want %s", i, p.Platform, platforms[i])
+		}
+		sum += p.ProcessedPrograms
+	}
+	if sum != programs {
+		t.Errorf("platforms add up to %d programs, want %d", sum, programs)
+	}
+}
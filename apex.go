@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// apexDomain returns the registered domain (eTLD+1) of fqdn, or "" if there is none
+func apexDomain(fqdn string) string {
+	fqdn = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(fqdn)), "*.")
+	apex, err := publicsuffix.EffectiveTLDPlusOne(strings.TrimSuffix(fqdn, "."))
+	if err != nil {
+		return ""
+	}
+	return apex
+}
+
+// groupByApex maps every registered domain to its FQDNs in input order.
+// FQDNs without a registered domain are grouped under their own name.
+func groupByApex(fqdns []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, fqdn := range fqdns {
+		apex := apexDomain(fqdn)
+		if apex == "" {
+			apex = fqdn
+		}
+		groups[apex] = append(groups[apex], fqdn)
+	}
+	return groups
+}
+
+// knownApexes collects the registered domains of all FQDNs below dir
+func knownApexes(dir string) map[string]bool {
+	known := make(map[string]bool)
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		for _, line := range lines {
+			if apex := apexDomain(line); apex != "" {
+				known[apex] = true
+			}
+		}
+		return nil
+	})
+	return known
+}
+
+// reportApexChanges logs how the new FQDNs of a program spread over
+// registered domains and how many of those were already in oldDir
+func reportApexChanges(newFQDNs []string, oldDir string) {
+	groups := groupByApex(newFQDNs)
+	known := knownApexes(oldDir)
+
+	knownCount := 0
+	for apex := range groups {
+		if known[apex] {
+			knownCount++
+		}
+	}
+	printEvent([]any{"new_fqdns", len(newFQDNs), "apex_domains", len(groups), "known_apex_domains", knownCount},
+		"%d new subdomains across %d apex domains (%d known, %d new)", len(newFQDNs), len(groups), knownCount, len(groups)-knownCount)
+}
+
+// writeApexGroups writes the FQDNs into one <apex>.txt per registered domain in dir
+func writeApexGroups(dir string, fqdns []string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for apex, group := range groupByApex(fqdns) {
+		path := filepath.Join(dir, sanitizeName(apex)+".txt")
+		if err := addUpdates(path, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
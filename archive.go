@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// zipUpdateDir packages the loose update tree dir into dir+".zip" and removes
+// the tree. Entries of an existing archive from an earlier run on the same
+// day are kept unless the tree contains a file with the same name.
+func zipUpdateDir(dir string) error {
+	zipPath := dir + ".zip"
+	tmpPath := zipPath + ".tmp"
+
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	w := zip.NewWriter(out)
+	written := make(map[string]bool)
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		written[name] = true
+		return addFileToZip(w, path, name)
+	})
+	if err == nil {
+		err = copyExistingZipEntries(w, zipPath, written)
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, zipPath); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func addFileToZip(w *zip.Writer, path, name string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dst, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, in)
+	return err
+}
+
+func copyExistingZipEntries(w *zip.Writer, zipPath string, skip map[string]bool) error {
+	r, err := zip.OpenReader(zipPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if skip[f.Name] {
+			continue
+		}
+		if err := w.Copy(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
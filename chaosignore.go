@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// chaosIgnoreFile at the output root lists programs and FQDNs to always skip
+const chaosIgnoreFile = ".chaosignore"
+
+// chaosIgnore holds the patterns of .chaosignore. A line is a glob pattern as
+// understood by path.Match, matched case-insensitively against program names
+// and FQDNs alike. The prefixes "program:" and "fqdn:" restrict a pattern to
+// one of them, lines starting with # are comments.
+type chaosIgnore struct {
+	programs []string
+	fqdns    []string
+}
+
+// loadChaosIgnore reads path, a missing file yields nil
+func loadChaosIgnore(path string) (*chaosIgnore, error) {
+	lines, err := readLines(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ignore := &chaosIgnore{}
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.ToLower(line)
+		if pattern, ok := strings.CutPrefix(line, "program:"); ok {
+			ignore.programs = append(ignore.programs, strings.TrimSpace(pattern))
+		} else if pattern, ok := strings.CutPrefix(line, "fqdn:"); ok {
+			ignore.fqdns = append(ignore.fqdns, strings.TrimSpace(pattern))
+		} else {
+			ignore.programs = append(ignore.programs, line)
+			ignore.fqdns = append(ignore.fqdns, line)
+		}
+	}
+	return ignore, nil
+}
+
+func matchAny(patterns []string, s string) bool {
+	s = strings.ToLower(s)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterEntries returns the entries whose program isn't ignored
+func (c *chaosIgnore) filterEntries(entries []Entry) []Entry {
+	var kept []Entry
+	for _, entry := range entries {
+		if !matchAny(c.programs, entry.Name) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// filterDir removes the ignored FQDNs from every file below dir and returns
+// how many were removed
+func (c *chaosIgnore) filterDir(dir string) int {
+	if len(c.fqdns) == 0 {
+		return 0
+	}
+	total := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		kept := c.filter(lines)
+		if len(kept) == len(lines) {
+			return nil
+		}
+		if err := writeLines(path, kept); err != nil {
+			printWarning("Error writing '%s': %v", path, err)
+			return nil
+		}
+		total += len(lines) - len(kept)
+		return nil
+	})
+	return total
+}
+
+// filter returns lines without the ignored FQDNs
+func (c *chaosIgnore) filter(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		if !matchAny(c.fqdns, line) {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
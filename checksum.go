@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// checksumsSuffix is appended to a program directory to get its sidecar
+// checksum file, e.g. hackerone/Domains/Alpha_Corp.checksums.txt
+const checksumsSuffix = ".checksums.txt"
+
+var hashAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"blake3": func() hash.Hash { return blake3.New() },
+	"xxhash": func() hash.Hash { return xxhash.New() },
+}
+
+func hashFile(path, algo string) (string, error) {
+	acquireFile()
+	defer releaseFile()
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := hashAlgos[algo]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksums hashes every file below dir and writes them to the sidecar
+// file of dir in the format of sha256sum, preceded by the algorithm
+func writeChecksums(dir, algo string) error {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", algo)
+	for _, path := range paths {
+		sum, err := hashFile(path, algo)
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(&b, "%s  %s\n", sum, filepath.ToSlash(relPath))
+	}
+
+	tmp := dir + checksumsSuffix + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir+checksumsSuffix)
+}
+
+// verifyChecksums compares the files below dir with its sidecar file and
+// returns the files that changed or went missing
+func verifyChecksums(dir string) (checked int, mismatched []string, err error) {
+	f, err := os.Open(dir + checksumsSuffix)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	algo := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if algo == "" {
+			algo = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			if hashAlgos[algo] == nil {
+				return 0, nil, fmt.Errorf("unknown hash algorithm '%s'", algo)
+			}
+			continue
+		}
+		sum, relPath, ok := strings.Cut(line, "  ")
+		if !ok {
+			return checked, mismatched, errors.New("malformed line: " + line)
+		}
+		checked++
+		actual, err := hashFile(filepath.Join(dir, filepath.FromSlash(relPath)), algo)
+		if err != nil || actual != sum {
+			mismatched = append(mismatched, relPath)
+		}
+	}
+	return checked, mismatched, scanner.Err()
+}
+
+// verifyArchive checks all programs below root that have a sidecar file and
+// returns false if any file does not match
+func verifyArchive(root string) bool {
+	ok := true
+	programs := 0
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, checksumsSuffix) {
+			return nil
+		}
+		dir := strings.TrimSuffix(path, checksumsSuffix)
+		programs++
+		checked, mismatched, err := verifyChecksums(dir)
+		switch {
+		case err != nil:
+			printError("Error verifying '%s': %v", dir, err)
+			ok = false
+		case len(mismatched) > 0:
+			printError("%s: %d of %d files changed or missing", dir, len(mismatched), checked)
+			for _, relPath := range mismatched {
+				printError("  %s", relPath)
+			}
+			ok = false
+		default:
+			printSuccess("%s: %d files OK", dir, checked)
+		}
+		return nil
+	})
+	printInfo("Verified %d programs", programs)
+	return ok
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressExtensions maps every -compress-algo to the extension appended to
+// the compressed history files
+var compressExtensions = map[string]string{
+	"gzip":   ".gz",
+	"zstd":   ".zst",
+	"brotli": ".br",
+}
+
+// openHistoryFile opens path and transparently decompresses it if the
+// extension marks it as compressed by -compress
+func openHistoryFile(path string) (io.ReadCloser, error) {
+	acquireFile()
+	rc, err := openHistoryReader(path)
+	if err != nil {
+		releaseFile()
+		return nil, err
+	}
+	return &releasingReadCloser{ReadCloser: rc}, nil
+}
+
+func openHistoryReader(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return readCloser{gz, f}, nil
+	case ".zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return zstdReadCloser{zr, f}, nil
+	case ".br":
+		return readCloser{brotli.NewReader(f), f}, nil
+	}
+	return f, nil
+}
+
+// zstdReadCloser releases the decoder together with the file
+type zstdReadCloser struct {
+	*zstd.Decoder
+	file *os.File
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return z.file.Close()
+}
+
+// findHistoryFile returns path if it exists and otherwise its compressed
+// variant, so the diff works on compressed and uncompressed histories alike
+func findHistoryFile(path string) (string, bool) {
+	if _, err := os.Stat(path); err == nil {
+		return path, true
+	}
+	for _, ext := range compressExtensions {
+		if _, err := os.Stat(path + ext); err == nil {
+			return path + ext, true
+		}
+	}
+	return path, false
+}
+
+func isCompressed(path string) bool {
+	for _, ext := range compressExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressDir replaces every uncompressed file below dir with a compressed
+// copy named after algo
+func compressDir(dir, algo string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isCompressed(path) {
+			return err
+		}
+		if err := compressFile(path, path+compressExtensions[algo], algo); err != nil {
+			return err
+		}
+		return os.Remove(path)
+	})
+}
+
+func compressFile(src, dst, algo string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	var w io.WriteCloser
+	switch algo {
+	case "zstd":
+		w, err = zstd.NewWriter(out)
+	case "brotli":
+		w = brotli.NewWriter(out)
+	default:
+		w = gzip.NewWriter(out)
+	}
+	if err == nil {
+		if _, err = io.Copy(w, in); err == nil {
+			err = w.Close()
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
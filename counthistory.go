@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countHistoryFile is the per-program time series of -count-history, kept in
+// <platform>/Counts/<program>/ so it never mixes with the domain files
+const countHistoryFile = "count_history.csv"
+
+var countHistoryHeader = []string{"date", "file_count", "fqdn_count", "new_fqdns"}
+
+func countHistoryPath(platformDir, name string) string {
+	return filepath.Join(platformDir, "Counts", name, countHistoryFile)
+}
+
+// appendCountHistory adds a row with the counts of this run to path, the
+// header is written with the first row
+func appendCountHistory(path string, files, fqdns, newFQDNs int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if os.IsNotExist(statErr) {
+		w.Write(countHistoryHeader)
+	}
+	w.Write([]string{time.Now().Format("2006-01-02"), strconv.Itoa(files), strconv.Itoa(fqdns), strconv.Itoa(newFQDNs)})
+	w.Flush()
+	err = w.Error()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// printCountTrend prints the count history of every program below root named
+// program, on any platform
+func printCountTrend(root, program string) error {
+	name := strings.ToLower(sanitizeName(program))
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && (d.Name() == "Domains" || strings.HasPrefix(d.Name(), updatesPrefix)) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == countHistoryFile &&
+			strings.ToLower(filepath.Base(filepath.Dir(path))) == name &&
+			filepath.Base(filepath.Dir(filepath.Dir(path))) == "Counts" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no %s found for program '%s', it is written with -count-history", countHistoryFile, program)
+	}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		rows, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading '%s': %w", path, err)
+		}
+
+		platform, _ := filepath.Rel(root, filepath.Dir(filepath.Dir(filepath.Dir(path))))
+		printHeader("%s [%s]", program, filepath.ToSlash(platform))
+		printStats("%-12s %8s %12s %10s %10s", "Date", "Files", "FQDNs", "Change", "New FQDNs")
+		printSeparator()
+		previous := -1
+		for _, row := range rows {
+			if len(row) != len(countHistoryHeader) || row[0] == countHistoryHeader[0] {
+				continue
+			}
+			fqdns, _ := strconv.Atoi(row[2])
+			change := ""
+			if previous >= 0 {
+				change = fmt.Sprintf("%+d", fqdns-previous)
+			}
+			previous = fqdns
+			printStats("%-12s %8s %12s %10s %10s", row[0], row[1], row[2], change, row[3])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// countMismatch compares the Count of an index entry with the FQDNs actually dumped
+type countMismatch struct {
+	Program  string
+	Platform string
+	Feed     int
+	Actual   int
+}
+
+func (c countMismatch) difference() int {
+	return c.Actual - c.Feed
+}
+
+// percent is the difference relative to the feed count, 100 for a feed count of 0
+func (c countMismatch) percent() float64 {
+	if c.Feed == 0 {
+		if c.Actual == 0 {
+			return 0
+		}
+		return 100
+	}
+	return float64(c.difference()) / float64(c.Feed) * 100
+}
+
+func (c countMismatch) flagged(tolerance float64) bool {
+	return math.Abs(c.percent()) > tolerance
+}
+
+// writeCountReport writes all programs as CSV, largest discrepancy first
+func writeCountReport(path string, report []countMismatch, tolerance float64) error {
+	sort.SliceStable(report, func(i, j int) bool {
+		return math.Abs(report[i].percent()) > math.Abs(report[j].percent())
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"program", "platform", "feed_count", "actual_count", "difference", "difference_percent", "flagged"})
+	for _, c := range report {
+		w.Write([]string{
+			c.Program,
+			c.Platform,
+			strconv.Itoa(c.Feed),
+			strconv.Itoa(c.Actual),
+			strconv.Itoa(c.difference()),
+			strconv.FormatFloat(c.percent(), 'f', 1, 64),
+			strconv.FormatBool(c.flagged(tolerance)),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// printCountMismatches lists the programs whose feed count is off by more than tolerance percent
+func printCountMismatches(report []countMismatch, tolerance float64) {
+	flagged := 0
+	for _, c := range report {
+		if c.flagged(tolerance) {
+			if flagged == 0 {
+				printHeader("Programs whose index count is off by more than %.0f%%:", tolerance)
+			}
+			printWarning("  %-40s index %8d, dumped %8d (%+.1f%%)", c.Program+" ["+c.Platform+"]", c.Feed, c.Actual, c.percent())
+			flagged++
+		}
+	}
+	if flagged == 0 {
+		printSuccess("All index counts are within %.0f%% of the dumped FQDNs", tolerance)
+	}
+}
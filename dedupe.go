@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fuzzyDedupe drops every line that only differs from another line of the
+// same set by one of prefixes, e.g. www.example.com or *.example.com when
+// example.com is present. It returns the remaining lines and the number of
+// collapsed ones.
+func fuzzyDedupe(lines []string, prefixes []string) ([]string, int) {
+	present := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		present[strings.ToLower(line)] = true
+	}
+
+	kept := lines[:0]
+	collapsed := 0
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		duplicate := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(lower, prefix) && present[lower[len(prefix):]] {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			collapsed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept, collapsed
+}
+
+// fuzzyDedupeDir applies fuzzyDedupe to every file below dir and returns
+// the total number of collapsed lines
+func fuzzyDedupeDir(dir string, prefixes []string) int {
+	total := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		kept, collapsed := fuzzyDedupe(lines, prefixes)
+		if collapsed == 0 {
+			return nil
+		}
+		if err := writeLines(path, kept); err != nil {
+			printWarning("Error writing deduplicated '%s': %v", path, err)
+			return nil
+		}
+		total += collapsed
+		return nil
+	})
+	return total
+}
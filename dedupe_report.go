@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// duplicationStats counts the lines of a program against its distinct FQDNs
+type duplicationStats struct {
+	Program  string
+	Platform string
+	Lines    int
+	Unique   int
+}
+
+func (d duplicationStats) duplicates() int {
+	return d.Lines - d.Unique
+}
+
+// ratio is the share of lines that are duplicates, between 0 and 1
+func (d duplicationStats) ratio() float64 {
+	if d.Lines == 0 {
+		return 0
+	}
+	return float64(d.duplicates()) / float64(d.Lines)
+}
+
+// countDuplicates walks all files of a program and builds the set of distinct FQDNs
+func countDuplicates(dir string) (int, int) {
+	lines := 0
+	unique := make(map[string]struct{})
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		fileLines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		lines += len(fileLines)
+		for _, line := range fileLines {
+			unique[line] = struct{}{}
+		}
+		return nil
+	})
+	return lines, len(unique)
+}
+
+func sortByDuplication(report []duplicationStats) {
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].ratio() != report[j].ratio() {
+			return report[i].ratio() > report[j].ratio()
+		}
+		return report[i].duplicates() > report[j].duplicates()
+	})
+}
+
+// writeDedupeReport writes all programs as CSV, most duplicated first
+func writeDedupeReport(path string, report []duplicationStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"program", "platform", "lines", "unique_fqdns", "duplicates", "duplicate_ratio"})
+	for _, d := range report {
+		w.Write([]string{
+			d.Program,
+			d.Platform,
+			strconv.Itoa(d.Lines),
+			strconv.Itoa(d.Unique),
+			strconv.Itoa(d.duplicates()),
+			strconv.FormatFloat(d.ratio(), 'f', 4, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func printDedupeReport(report []duplicationStats, n int) {
+	printHeader("Most duplicated programs:")
+	for i, d := range report {
+		if i == n || d.duplicates() == 0 {
+			break
+		}
+		printStats("  %-40s %8d lines %8d unique  %5.1f%% duplicates", d.Program+" ["+d.Platform+"]", d.Lines, d.Unique, d.ratio()*100)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyNewDomainsCRLFHistory(t *testing.T) {
+	setOpts(t, nil)
+	newDir, oldDir, updateDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(oldDir, "example.com.txt"), "a.example.com\r\nb.example.com\r\n")
+	writeFile(t, filepath.Join(newDir, "example.com.txt"), "a.example.com\nb.example.com\n")
+
+	files, fqdns := copyNewDomains(newDir, oldDir, updateDir, "Acme", "hackerone")
+	if files != 0 || len(fqdns) != 0 {
+		t.Errorf("CRLF history reported %d files with new lines %q, want none", files, fqdns)
+	}
+	if n := countFilesInDir(updateDir); n != 0 {
+		t.Errorf("%d update files written, want none", n)
+	}
+}
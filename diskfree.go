@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// diskPause is how long a program waits for disk space to be freed, e.g. by
+// other programs finishing, before the run is aborted
+const diskPause = time.Minute
+
+// lowDiskSpace returns the first of the output and the temp directory with
+// less than -min-free-disk bytes free, or "" if both have enough. Filesystems
+// whose free space can't be determined are not checked.
+func lowDiskSpace() (string, uint64) {
+	for _, dir := range []string{".", os.TempDir()} {
+		free, err := freeDiskSpace(dir)
+		if err == nil && free < uint64(opts.minFreeDisk) {
+			return dir, free
+		}
+	}
+	return "", 0
+}
+
+// waitForDiskSpace pauses once if the free disk space is below -min-free-disk
+// and returns an error if it still is afterwards
+func waitForDiskSpace() error {
+	dir, free := lowDiskSpace()
+	if dir == "" {
+		return nil
+	}
+	printWarning("Only %d MB free on the filesystem of '%s', below -min-free-disk. Pausing for %s", free>>20, dir, diskPause)
+	time.Sleep(diskPause)
+	if dir, free = lowDiskSpace(); dir == "" {
+		return nil
+	}
+	return fmt.Errorf("only %d MB free on the filesystem of '%s', below -min-free-disk of %d MB", free>>20, dir, opts.minFreeDisk>>20)
+}
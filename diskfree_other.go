@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// freeDiskSpace is not implemented on this platform, -min-free-disk is ignored
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errors.New("free disk space not supported on this platform")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// zipArchive is a downloaded archive. Small archives are kept in memory,
+// larger ones are spooled to a temp file to bound memory usage.
+type zipArchive struct {
+	data []byte
+	path string
+	size int64
+	file *os.File
+	// keep leaves the file of a persisted archive in place on Close
+	keep bool
+}
+
+// readArchive reads r into memory while it stays within threshold bytes and
+// spools it to a temp file beyond that. A negative threshold never spools,
+// zero always does.
+func readArchive(r io.Reader, threshold int64) (*zipArchive, error) {
+	var buf bytes.Buffer
+	if threshold != 0 {
+		limit := threshold + 1
+		if threshold < 0 {
+			limit = -1
+		}
+		var err error
+		if limit < 0 {
+			_, err = io.Copy(&buf, r)
+		} else {
+			_, err = io.Copy(&buf, io.LimitReader(r, limit))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if threshold < 0 || int64(buf.Len()) <= threshold {
+			return &zipArchive{data: buf.Bytes(), size: int64(buf.Len())}, nil
+		}
+	}
+
+	f, err := os.CreateTemp("", "chaos_download_*.zip")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(f, io.MultiReader(&buf, r))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &zipArchive{path: f.Name(), size: size}, nil
+}
+
+func (a *zipArchive) Size() int64 {
+	return a.size
+}
+
+// open returns a reader for the archive, spooled archives stay open until Close
+func (a *zipArchive) open() (*zip.Reader, error) {
+	if a.path == "" {
+		return zip.NewReader(bytes.NewReader(a.data), a.size)
+	}
+	if a.file == nil {
+		f, err := os.Open(a.path)
+		if err != nil {
+			return nil, err
+		}
+		a.file = f
+	}
+	return zip.NewReader(a.file, a.size)
+}
+
+// Close releases the memory and removes the temp file of a spooled archive
+func (a *zipArchive) Close() error {
+	a.data = nil
+	if a.path == "" {
+		return nil
+	}
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+	if a.keep {
+		return nil
+	}
+	return os.Remove(a.path)
+}
+
+// resumeMaxAge limits how old a download left behind by an interrupted run
+// may be to be used again, older ones likely miss updates of the feed
+const resumeMaxAge = 24 * time.Hour
+
+// resumePath is where -resume keeps the download of url until its program is done
+func resumePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(os.TempDir(), "chaos_downloads", hex.EncodeToString(sum[:16])+".zip")
+}
+
+// loadResumed returns the download of url an interrupted run left behind,
+// or nil if there is none or it is too old
+func loadResumed(url string) *zipArchive {
+	path := resumePath(url)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > resumeMaxAge {
+		return nil
+	}
+	return &zipArchive{path: path, size: info.Size(), keep: true}
+}
+
+// persist moves the archive to path, where it survives Close and the end of
+// the process. A partial file is never left at path.
+func (a *zipArchive) persist(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if a.path == "" {
+		tmpPath := path + ".part"
+		if err := os.WriteFile(tmpPath, a.data, 0644); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return err
+		}
+	} else {
+		if a.file != nil {
+			a.file.Close()
+			a.file = nil
+		}
+		if err := os.Rename(a.path, path); err != nil {
+			return err
+		}
+		a.path = path
+	}
+	a.keep = true
+	return nil
+}
+
+// archiveCache shares the archive of a URL listed by several index entries,
+// so it is only downloaded once per run
+type archiveCache struct {
+	mu       sync.Mutex
+	pending  map[string]int
+	archives map[string]*zipArchive
+}
+
+// newArchiveCache counts how many entries still need each URL
+func newArchiveCache(entries []Entry) *archiveCache {
+	c := &archiveCache{pending: make(map[string]int), archives: make(map[string]*zipArchive)}
+	for _, entry := range entries {
+		c.pending[entry.URL]++
+	}
+	return c
+}
+
+// get returns the archive of url if an earlier entry already downloaded it
+func (c *archiveCache) get(url string) (*zipArchive, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.archives[url]
+	return a, ok
+}
+
+// put keeps the archive for the remaining entries with the same url
+func (c *archiveCache) put(url string, a *zipArchive) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[url] > 1 {
+		c.archives[url] = a
+	}
+}
+
+// release marks one entry of url as done and closes the archive once no
+// other entry needs it anymore. a may be nil after a failed download.
+func (c *archiveCache) release(url string, a *zipArchive) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[url]--
+	if a == nil || (c.archives[url] == a && c.pending[url] > 0) {
+		return
+	}
+	delete(c.archives, url)
+	a.Close()
+}
+
+// closeAll closes the archives left over by entries that were never processed
+func (c *archiveCache) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for url, a := range c.archives {
+		a.Close()
+		delete(c.archives, url)
+	}
+}
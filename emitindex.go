@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// writeEmitIndex republishes the processed programs as chaos index at path.
+// The history of every program is packed into <platform>/<program>.zip next
+// to the index, its URL is that relative path behind urlPrefix.
+func writeEmitIndex(path, urlPrefix string, results []ProgramResult) (int, error) {
+	root := filepath.Dir(path)
+	now := time.Now().UTC().Format(time.RFC3339)
+	entries := []Entry{}
+	for _, result := range results {
+		if result.domainDir == "" {
+			continue
+		}
+		relPath := filepath.Join(result.Platform, sanitizeName(result.Program)+".zip")
+		if err := os.MkdirAll(filepath.Join(root, result.Platform), 0755); err != nil {
+			return 0, err
+		}
+		if err := zipDomainDir(result.domainDir, filepath.Join(root, relPath)); err != nil {
+			return 0, err
+		}
+		entries = append(entries, Entry{
+			Name:        result.Entry.Name,
+			ProgramURL:  result.Entry.ProgramURL,
+			URL:         urlPrefix + filepath.ToSlash(relPath),
+			Count:       result.FQDNCount,
+			Change:      result.NewFQDNs,
+			IsNew:       result.Entry.IsNew,
+			Platform:    result.Entry.Platform,
+			Bounty:      result.Entry.Bounty,
+			LastUpdated: now,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Platform != entries[j].Platform {
+			return entries[i].Platform < entries[j].Platform
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return 0, err
+	}
+	return len(entries), os.Rename(tmpPath, path)
+}
+
+// zipDomainDir packs the history in dir into zipPath the way chaos does, one
+// uncompressed-named text file per second-level domain
+func zipDomainDir(dir, zipPath string) error {
+	tmpPath := zipPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	w := zip.NewWriter(out)
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		for _, ext := range compressExtensions {
+			name = strings.TrimSuffix(name, ext)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		in, err := openHistoryFile(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		dst, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: info.ModTime()})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, in)
+		return err
+	})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, zipPath)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// EntryResult is an index entry enriched with what was actually dumped
+// during this run, for comparing the feed's Count with reality
+type EntryResult struct {
+	Entry
+	FileCount    int    `json:"file_count"`
+	FQDNCount    int    `json:"fqdn_count"`
+	NewFQDNCount int    `json:"new_fqdn_count"`
+	Error        string `json:"error,omitempty"`
+}
+
+func writeEntriesJSON(path string, results []EntryResult) error {
+	if results == nil {
+		results = []EntryResult{}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// shortWriter accepts only the first limit bytes, like a disk filling up
+type shortWriter struct {
+	f     *os.File
+	limit int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		p = p[:w.limit]
+	}
+	n, err := w.f.Write(p)
+	w.limit -= n
+	return n, err
+}
+
+func (w *shortWriter) Close() error {
+	return w.f.Close()
+}
+
+// failWrites makes every extracted file accept only limit bytes
+func failWrites(t *testing.T, limit int) {
+	t.Helper()
+	saved := createExtracted
+	createExtracted = func(path string) (io.WriteCloser, error) {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &shortWriter{f: f, limit: limit}, nil
+	}
+	t.Cleanup(func() { createExtracted = saved })
+}
+
+func TestExtractZipShortWriteLeavesNoPartialFile(t *testing.T) {
+	setOpts(t, nil)
+	failWrites(t, 5)
+	data := makeZip(t, map[string]string{"example.com.txt": "a.example.com\nb.example.com\n"})
+	outDir := t.TempDir()
+
+	_, _, err := extractZip(&zipArchive{data: data, size: int64(len(data))}, outDir)
+	if err == nil {
+		t.Fatal("short write was not reported")
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "example.com.txt")); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+}
+
+func TestExtractZipReportsCreateErrors(t *testing.T) {
+	setOpts(t, nil)
+	saved := createExtracted
+	createExtracted = func(path string) (io.WriteCloser, error) {
+		return nil, os.ErrPermission
+	}
+	t.Cleanup(func() { createExtracted = saved })
+	data := makeZip(t, map[string]string{"example.com.txt": "a.example.com\n"})
+
+	if _, _, err := extractZip(&zipArchive{data: data, size: int64(len(data))}, t.TempDir()); err == nil {
+		t.Fatal("create error was swallowed")
+	}
+}
+
+func TestExtractZipRejectsCorruptArchive(t *testing.T) {
+	setOpts(t, nil)
+	data := []byte("<html>rate limited</html>")
+	if _, _, err := extractZip(&zipArchive{data: data, size: int64(len(data))}, t.TempDir()); err == nil {
+		t.Fatal("corrupt archive extracted without an error")
+	}
+}
+
+func TestProcessSkipsSwapOnWriteError(t *testing.T) {
+	setOpts(t, nil)
+	inTempDir(t)
+	history := filepath.Join("hackerone", "Domains", "Acme")
+	writeFile(t, filepath.Join(history, "example.com.txt"), "old.example.com\n")
+	writeFile(t, filepath.Join(history, "other.com.txt"), "www.other.com\n")
+
+	srv := zipServer(t, makeZip(t, map[string]string{
+		"example.com.txt": "old.example.com\nnew.example.com\n",
+		"other.com.txt":   "www.other.com\n",
+	}))
+	entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+	failWrites(t, 5)
+
+	result := newTestProcessor([]Entry{entry}).process(entry)
+	if result.Err == nil || result.Success {
+		t.Fatalf("process succeeded despite the failed write: %+v", result)
+	}
+	for name, want := range map[string]string{"example.com.txt": "old.example.com\n", "other.com.txt": "www.other.com\n"} {
+		got, err := os.ReadFile(filepath.Join(history, name))
+		if err != nil || string(got) != want {
+			t.Errorf("history file %s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if updates, _ := filepath.Glob(filepath.Join("hackerone", updatesPrefix+"*")); len(updates) > 0 {
+		t.Errorf("updates written for a failed extraction: %v", updates)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+const failedFile = "failed.json"
+
+// FailedProgram is a program whose last attempt failed, it is kept in
+// failed.json until a later run processes it successfully
+type FailedProgram struct {
+	Name     string    `json:"name"`
+	Platform string    `json:"platform"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type failedPrograms map[string]FailedProgram
+
+func failedKey(entry Entry) string {
+	return entry.Platform + "\x00" + entry.Name
+}
+
+func loadFailedPrograms(path string) (failedPrograms, error) {
+	failed := make(failedPrograms)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return failed, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var list []FailedProgram
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, program := range list {
+		failed[failedKey(Entry{Name: program.Name, Platform: program.Platform})] = program
+	}
+	return failed, nil
+}
+
+func (f failedPrograms) record(entry Entry, err error) {
+	f[failedKey(entry)] = FailedProgram{
+		Name:     entry.Name,
+		Platform: entry.Platform,
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+	}
+}
+
+func (f failedPrograms) clear(entry Entry) {
+	delete(f, failedKey(entry))
+}
+
+func (f failedPrograms) contains(entry Entry) bool {
+	_, ok := f[failedKey(entry)]
+	return ok
+}
+
+// save writes the failed programs sorted by platform and name, an empty list removes the file
+func (f failedPrograms) save(path string) error {
+	if len(f) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	list := make([]FailedProgram, 0, len(f))
+	for _, program := range f {
+		list = append(list, program)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Platform != list[j].Platform {
+			return list[i].Platform < list[j].Platform
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// openFiles bounds the files opened at the same time by the per-program file
+// operations, nil means no limit. Every holder opens a single file at a time,
+// so a program can never wait for a slot it holds itself.
+var openFiles chan struct{}
+
+// initOpenFiles sets up -max-open-files. 0 derives the limit from half the
+// soft limit of the process, so the log, sockets and the archives keep room.
+func initOpenFiles(limit int) {
+	if limit == 0 {
+		limit = systemOpenFileLimit() / 2
+	}
+	if limit > 0 {
+		openFiles = make(chan struct{}, limit)
+	}
+}
+
+func acquireFile() {
+	if openFiles != nil {
+		openFiles <- struct{}{}
+	}
+}
+
+func releaseFile() {
+	if openFiles != nil {
+		<-openFiles
+	}
+}
+
+// releasingReadCloser gives the slot back once the file is closed
+type releasingReadCloser struct {
+	io.ReadCloser
+	once sync.Once
+}
+
+func (r *releasingReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(releaseFile)
+	return err
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+// systemOpenFileLimit is not known on this platform, files are not limited
+// unless -max-open-files is set
+func systemOpenFileLimit() int {
+	return 0
+}
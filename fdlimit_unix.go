@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import "syscall"
+
+// systemOpenFileLimit returns the soft limit of open files, 0 if unknown or
+// practically unlimited
+func systemOpenFileLimit() int {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil || rl.Cur > 1<<20 {
+		return 0
+	}
+	return int(rl.Cur)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shellCommand runs command through the platform shell, so users can pass
+// pipelines and arguments the same way they would type them
+func shellCommand(command string) *exec.Cmd {
+	return shellCommandContext(context.Background(), command)
+}
+
+// shellCommandContext is shellCommand killed once ctx is done
+func shellCommandContext(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// filterLines sends lines to the -filter-cmd on stdin and returns the lines
+// the command printed that were part of the input. The command is killed
+// after -filter-timeout.
+func filterLines(command string, lines []string) ([]string, error) {
+	ctx := context.Background()
+	if opts.filterTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.filterTimeout)
+		defer cancel()
+	}
+	cmd := shellCommandContext(ctx, command)
+	// Children of the shell may hold on to stdout after it was killed
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timed out after %s", opts.filterTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, &filterError{err: err, stderr: msg}
+		}
+		return nil, err
+	}
+
+	input := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		input[line] = true
+	}
+	var kept []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimRight(line, "\r")
+		// The command may only remove lines, never add new ones
+		if input[line] {
+			kept = append(kept, line)
+			delete(input, line)
+		}
+	}
+	return kept, nil
+}
+
+type filterError struct {
+	err    error
+	stderr string
+}
+
+func (e *filterError) Error() string {
+	return e.err.Error() + ": " + e.stderr
+}
+
+// filterDir runs the -filter-cmd once per file below dir, with at most
+// concurrency commands at a time. It returns the number of lines removed, or
+// the first failure of the command, after which no further files are
+// filtered.
+func filterDir(dir, command string, concurrency int) (int, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		removed  int
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		if failed() {
+			wg.Done()
+			<-sem
+			return filepath.SkipAll
+		}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			lines, err := readLines(path)
+			if err == nil && len(lines) > 0 {
+				var kept []string
+				if kept, err = filterLines(command, lines); err != nil {
+					err = fmt.Errorf("'%s': %w", path, err)
+				} else if len(kept) != len(lines) {
+					if err = writeLines(path, kept); err != nil {
+						err = fmt.Errorf("writing '%s': %w", path, err)
+					}
+				}
+				if err == nil {
+					mu.Lock()
+					removed += len(lines) - len(kept)
+					mu.Unlock()
+				}
+			}
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+		return nil
+	})
+	wg.Wait()
+	return removed, firstErr
+}
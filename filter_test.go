@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterLinesTimeout(t *testing.T) {
+	setOpts(t, func(o *options) { o.filterTimeout = 100 * time.Millisecond })
+	start := time.Now()
+	_, err := filterLines("cat; sleep 10", []string{"a.example.com"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("filterLines = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("filterLines took %s to give up", elapsed)
+	}
+}
+
+// TestProcessSkipsSwapOnFilterFailure checks that a failing or hanging filter
+// fails the program instead of writing unfiltered FQDNs to the history
+func TestProcessSkipsSwapOnFilterFailure(t *testing.T) {
+	for name, command := range map[string]string{
+		"exit status": "grep -v drop; exit 3",
+		"timeout":     "sleep 10",
+	} {
+		t.Run(name, func(t *testing.T) {
+			setOpts(t, func(o *options) {
+				o.filterCmd = command
+				o.filterTimeout = 200 * time.Millisecond
+			})
+			inTempDir(t)
+			history := filepath.Join("hackerone", "Domains", "Acme")
+			writeFile(t, filepath.Join(history, "example.com.txt"), "old.example.com\n")
+
+			srv := zipServer(t, makeZip(t, map[string]string{
+				"example.com.txt": "old.example.com\ndrop.example.com\nnew.example.com\n",
+			}))
+			entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+
+			result := newTestProcessor([]Entry{entry}).process(entry)
+			if result.Err == nil || result.Success {
+				t.Fatalf("process succeeded despite the failed filter: %+v", result)
+			}
+			got, err := os.ReadFile(filepath.Join(history, "example.com.txt"))
+			if err != nil || string(got) != "old.example.com\n" {
+				t.Errorf("history = %q, %v, want it untouched", got, err)
+			}
+			if updates, _ := filepath.Glob(filepath.Join("hackerone", updatesPrefix+"*")); len(updates) > 0 {
+				t.Errorf("updates written despite the failed filter: %v", updates)
+			}
+		})
+	}
+}
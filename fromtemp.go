@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempRoot is the directory below os.TempDir() programs are extracted into.
+// A -from-temp run extracts elsewhere, so the saved extraction it reads, e.g.
+// one kept by -keep-temp, is never replaced.
+func tempRoot() string {
+	if opts.fromTemp != "" {
+		return "chaos_temp_replay"
+	}
+	return "chaos_temp"
+}
+
+// replayExtraction copies the saved extraction of a program in dir for
+// -from-temp into tempDir, where it stands in for the download and the
+// extraction. Compressed files are stored plain like extractZip writes them.
+// Hard links would save the copy, but the steps after the extraction rewrite
+// the files in place and would change the saved extraction. It returns the
+// number of files and FQDNs the same way as extractZip.
+func replayExtraction(dir, tempDir string) (int, int, error) {
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tempDir, relPath)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		for _, ext := range compressExtensions {
+			target = strings.TrimSuffix(target, ext)
+		}
+		return copyHistoryFile(path, target)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	files, fqdns := countDomainsAndFQDNs(tempDir)
+	return files, fqdns, nil
+}
+
+// copyHistoryFile writes the plain content of the history file src to dst
+func copyHistoryFile(src, dst string) error {
+	acquireFile()
+	defer releaseFile()
+	in, err := openHistoryReader(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkFromTemp rejects a -from-temp directory the run itself extracts into
+func checkFromTemp(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	replay := filepath.Join(os.TempDir(), tempRoot())
+	if abs == replay || strings.HasPrefix(abs, replay+string(filepath.Separator)) {
+		return fmt.Errorf("the run itself extracts into '%s'", replay)
+	}
+	return nil
+}
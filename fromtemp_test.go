@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestProcessFromTemp diffs a saved extraction against the history without
+// downloading, and leaves the saved files as they were
+func TestProcessFromTemp(t *testing.T) {
+	inTempDir(t)
+	setOpts(t, func(o *options) {
+		o.fromTemp = "saved"
+		o.filterCmd = "grep -v drop"
+	})
+	history := filepath.Join("hackerone", "Domains", "Acme")
+	writeFile(t, filepath.Join(history, "example.com.txt"), "old.example.com\n")
+
+	saved := filepath.Join("saved", "hackerone", "Acme")
+	savedPlain := "old.example.com\nnew.example.com\ndrop.example.com\n"
+	writeFile(t, filepath.Join(saved, "example.com.txt"), savedPlain)
+	savedGzip := gzipData(t, []byte("www.other.com\n"))
+	writeFile(t, filepath.Join(saved, "other.com.txt.gz"), string(savedGzip))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected download of %s", r.URL)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+
+	result := newTestProcessor([]Entry{entry}).process(entry)
+	if !result.Success {
+		t.Fatalf("process failed: %v", result.Err)
+	}
+	if result.FileCount != 2 || result.FQDNCount != 3 || result.NewFQDNs != 2 {
+		t.Errorf("counted %d files, %d FQDNs, %d new, want 2, 3, 2", result.FileCount, result.FQDNCount, result.NewFQDNs)
+	}
+	for name, want := range map[string]string{
+		"example.com.txt": "old.example.com\nnew.example.com\n",
+		"other.com.txt":   "www.other.com\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(history, name))
+		if err != nil || string(got) != want {
+			t.Errorf("history file %s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	if got, err := os.ReadFile(filepath.Join(saved, "example.com.txt")); err != nil || string(got) != savedPlain {
+		t.Errorf("saved extraction changed to %q, %v", got, err)
+	}
+	if got, err := os.ReadFile(filepath.Join(saved, "other.com.txt.gz")); err != nil || string(got) != string(savedGzip) {
+		t.Errorf("saved gzip file changed: %v", err)
+	}
+}
+
+func TestProcessFromTempMissing(t *testing.T) {
+	inTempDir(t)
+	setOpts(t, func(o *options) { o.fromTemp = "saved" })
+	os.Mkdir("saved", 0755)
+	entry := Entry{Name: "Acme", URL: "http://127.0.0.1:1/acme.zip", Platform: "hackerone"}
+
+	result := newTestProcessor([]Entry{entry}).process(entry)
+	if result.Success || result.Err == nil {
+		t.Fatalf("process succeeded without a saved extraction: %+v", result)
+	}
+}
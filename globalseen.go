@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// globalSeenFile lists every FQDN ever reported as new with -global-new-only
+const globalSeenFile = "all_seen.txt"
+
+// globalNew is the set of -global-new-only, nil without the flag
+var globalNew *globalSet
+
+// globalSet remembers FQDNs across all programs and runs, so a host shared by
+// several programs is reported as new only once
+type globalSet struct {
+	mu    sync.Mutex
+	fqdns map[string]bool
+	added []string
+}
+
+func loadGlobalSet(path string) (*globalSet, error) {
+	s := &globalSet{fqdns: make(map[string]bool)}
+	lines, err := readLines(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range lines {
+		s.fqdns[line] = true
+	}
+	return s, nil
+}
+
+// claim returns the FQDNs not reported before and records them, together
+// with the number of those left out
+func (s *globalSet) claim(fqdns []string) ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fresh []string
+	for _, fqdn := range fqdns {
+		if s.fqdns[fqdn] {
+			continue
+		}
+		s.fqdns[fqdn] = true
+		s.added = append(s.added, fqdn)
+		fresh = append(fresh, fqdn)
+	}
+	return fresh, len(fqdns) - len(fresh)
+}
+
+// release forgets FQDNs claimed in this run whose update file could not be
+// written, so they are not left out as already reported
+func (s *globalSet) release(fqdns []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	released := make(map[string]bool, len(fqdns))
+	for _, fqdn := range fqdns {
+		delete(s.fqdns, fqdn)
+		released[fqdn] = true
+	}
+	s.added = slices.DeleteFunc(s.added, func(fqdn string) bool { return released[fqdn] })
+}
+
+// save appends the FQDNs claimed in this run to path
+func (s *globalSet) save(path string) error {
+	if len(s.added) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strings.Join(s.added, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// failingOutput is an Output whose update files can't be written
+type failingOutput struct{ fileOutput }
+
+func (failingOutput) WriteNewFQDNs(program, platform, updateDir, relPath string, fqdns []string) error {
+	return errors.New("disk full")
+}
+
+func TestGlobalNewReleasedOnFailedWrite(t *testing.T) {
+	setOpts(t, nil)
+	defer func(previous *globalSet, out Output) { globalNew, output = previous, out }(globalNew, output)
+	globalNew = &globalSet{fqdns: make(map[string]bool)}
+	output = failingOutput{}
+
+	newDir, oldDir, updateDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(newDir, "example.com.txt"), "a.example.com\nb.example.com\n")
+	writeFile(t, filepath.Join(oldDir, "example.com.txt"), "a.example.com\n")
+	writeFile(t, filepath.Join(newDir, "other.com.txt"), "a.other.com\n")
+
+	if count, fqdns := copyNewDomains(newDir, oldDir, updateDir, "Acme", "hackerone"); count != 0 || len(fqdns) != 0 {
+		t.Errorf("failed writes reported %d files with %q", count, fqdns)
+	}
+	if count, fqdns := copyAllDomains(newDir, updateDir, "Acme", "hackerone"); count != 0 || len(fqdns) != 0 {
+		t.Errorf("failed writes reported %d files with %q", count, fqdns)
+	}
+	if len(globalNew.fqdns) != 0 || len(globalNew.added) != 0 {
+		t.Errorf("claims kept after failed writes: %v %q", globalNew.fqdns, globalNew.added)
+	}
+
+	output = fileOutput{}
+	if _, fqdns := copyNewDomains(newDir, oldDir, updateDir, "Acme", "hackerone"); len(fqdns) != 2 {
+		t.Errorf("retry reported %q, want both new FQDNs", fqdns)
+	}
+	if _, fqdns := copyNewDomains(newDir, oldDir, updateDir, "Other", "hackerone"); len(fqdns) != 0 {
+		t.Errorf("FQDNs reported twice: %q", fqdns)
+	}
+}
@@ -1,3 +1,16 @@
 module github.com/m10x/ChaosDomainDumper
 
 go 1.23.4
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/klauspost/compress v1.17.11
+	github.com/zeebo/blake3 v0.2.4
+	golang.org/x/net v0.38.0
+)
+
+require (
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+	golang.org/x/text v0.23.0 // indirect
+)
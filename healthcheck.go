@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// healthcheck loads every index source and checks that it looks sane,
+// without downloading any archive. It returns false if any check fails.
+func healthcheck(sources []string, minEntries int) bool {
+	healthy := true
+	for _, source := range sources {
+		entries, _, err := fetchIndex(source)
+		if err != nil {
+			printError("Index '%s' is unhealthy: %v", source, err)
+			healthy = false
+			continue
+		}
+		if err := checkIndex(entries, minEntries); err != nil {
+			printError("Index '%s' is unhealthy: %v", source, err)
+			healthy = false
+			continue
+		}
+
+		platforms := make(map[string]bool)
+		bounty, total := 0, 0
+		for _, entry := range entries {
+			platforms[entry.Platform] = true
+			if entry.Bounty {
+				bounty++
+			}
+			total += entry.Count
+		}
+		printEvent([]any{"source", source, "entries", len(entries), "platforms", len(platforms), "bounty_programs", bounty, "fqdns", total},
+			"Index '%s' is healthy: %d entries, %d platforms, %d bounty programs, %d FQDNs", source, len(entries), len(platforms), bounty, total)
+	}
+	return healthy
+}
+
+// checkIndex rejects an index with too few entries or entries that can't be processed
+func checkIndex(entries []Entry, minEntries int) error {
+	if len(entries) < minEntries {
+		return fmt.Errorf("only %d entries, expected at least %d", len(entries), minEntries)
+	}
+	missing := 0
+	for _, entry := range entries {
+		if strings.TrimSpace(entry.Name) == "" || strings.TrimSpace(entry.URL) == "" {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d entries without a name or URL", missing)
+	}
+	return nil
+}
+
+// checkIndexSchema rejects an index that decoded into obviously broken
+// entries, as happens when the upstream format changes and the fields no
+// longer match. Processing it would rewrite the history against garbage.
+func checkIndexSchema(entries []Entry) error {
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries")
+	}
+	names, urls, counts := 0, 0, 0
+	for _, entry := range entries {
+		if strings.TrimSpace(entry.Name) != "" {
+			names++
+		}
+		if strings.TrimSpace(entry.URL) != "" {
+			urls++
+		}
+		if entry.Count != 0 {
+			counts++
+		}
+	}
+	switch {
+	case names == 0:
+		return fmt.Errorf("none of the %d entries has a name", len(entries))
+	case urls == 0:
+		return fmt.Errorf("none of the %d entries has a URL", len(entries))
+	case counts == 0 && len(entries) > 1:
+		return fmt.Errorf("all %d entries have a count of 0", len(entries))
+	}
+	return nil
+}
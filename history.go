@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// syncHistory updates historyDir to match newDir while leaving files with
+// identical FQDNs untouched, even if they are compressed or carry an older
+// -metadata-header. Changed and new files are moved over, files that vanished
+// from newDir are removed. newDir is deleted afterwards.
+func syncHistory(newDir, historyDir string) (int, int, error) {
+	written, removed := 0, 0
+	present := make(map[string]bool)
+
+	err := filepath.WalkDir(newDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(newDir, path)
+		if err != nil {
+			return err
+		}
+		present[relPath] = true
+
+		historyPath := filepath.Join(historyDir, relPath)
+		if oldPath, exists := findHistoryFile(historyPath); exists {
+			if same, _ := sameFQDNs(path, oldPath); same {
+				// Keeps a compressed variant from being removed below
+				oldRel, _ := filepath.Rel(historyDir, oldPath)
+				present[oldRel] = true
+				return nil
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, historyPath); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return written, removed, err
+	}
+
+	var emptyDirs []string
+	filepath.WalkDir(historyDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != historyDir {
+				emptyDirs = append(emptyDirs, path)
+			}
+			return nil
+		}
+		relPath, _ := filepath.Rel(historyDir, path)
+		if !present[relPath] && os.Remove(path) == nil {
+			removed++
+		}
+		return nil
+	})
+	// Deepest directories come last in walk order, os.Remove only succeeds on empty ones
+	for i := len(emptyDirs) - 1; i >= 0; i-- {
+		os.Remove(emptyDirs[i])
+	}
+
+	return written, removed, os.RemoveAll(newDir)
+}
+
+// mergeHistory merges newDir into historyDir for -additive: every file gets
+// the union of its FQDNs, files only in the history are kept as they are.
+// A compressed history file is replaced by the uncompressed union. It returns
+// the number of files written, newDir is deleted afterwards. New and merged
+// files are both written through the output.
+func mergeHistory(newDir, historyDir, program, platform string) (int, error) {
+	written := 0
+	err := filepath.WalkDir(newDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(newDir, path)
+		if err != nil {
+			return err
+		}
+		historyPath := filepath.Join(historyDir, relPath)
+		oldPath, exists := findHistoryFile(historyPath)
+		if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
+			return err
+		}
+		newLines, err := readLines(path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			written++
+			return output.WriteHistoryFile(program, platform, historyDir, relPath, newLines)
+		}
+
+		oldLines, err := readLines(oldPath)
+		if err != nil {
+			return err
+		}
+		present := make(map[string]bool, len(oldLines))
+		for _, line := range oldLines {
+			present[line] = true
+		}
+		merged := oldLines
+		for _, line := range newLines {
+			if !present[line] {
+				present[line] = true
+				merged = append(merged, line)
+			}
+		}
+		if len(merged) == len(oldLines) {
+			return nil
+		}
+		if err := output.WriteHistoryFile(program, platform, historyDir, relPath, merged); err != nil {
+			return err
+		}
+		if oldPath != historyPath {
+			os.Remove(oldPath)
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, os.RemoveAll(newDir)
+}
+
+// sameFQDNs reports whether both files hold the same FQDNs in the same
+// order. readLines decompresses them and skips comment lines.
+func sameFQDNs(a, b string) (bool, error) {
+	linesA, err := readLines(a)
+	if err != nil {
+		return false, err
+	}
+	linesB, err := readLines(b)
+	if err != nil {
+		return false, err
+	}
+	return slices.Equal(linesA, linesB), nil
+}
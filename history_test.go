@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSyncHistoryCompressed(t *testing.T) {
+	setOpts(t, nil)
+	historyDir := t.TempDir()
+	for _, name := range []string{"same.com.txt", "changed.com.txt"} {
+		plain := filepath.Join(historyDir, name)
+		writeFile(t, plain, "a."+name+"\n")
+		if err := compressFile(plain, plain+".gz", "gzip"); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(plain)
+	}
+	newDir := t.TempDir()
+	writeFile(t, filepath.Join(newDir, "same.com.txt"), "a.same.com.txt\n")
+	writeFile(t, filepath.Join(newDir, "changed.com.txt"), "a.changed.com.txt\nb.changed.com.txt\n")
+
+	written, removed, err := syncHistory(newDir, historyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 1 || removed != 1 {
+		t.Errorf("written %d removed %d, want the changed file replaced", written, removed)
+	}
+	if _, err := os.Stat(filepath.Join(historyDir, "same.com.txt.gz")); err != nil {
+		t.Errorf("unchanged compressed file is gone: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(historyDir, "same.com.txt")); !os.IsNotExist(err) {
+		t.Errorf("unchanged file was written next to its compressed copy: %v", err)
+	}
+	if lines, err := readLines(filepath.Join(historyDir, "changed.com.txt")); err != nil || len(lines) != 2 {
+		t.Errorf("changed file = %q, %v", lines, err)
+	}
+	if _, err := os.Stat(filepath.Join(historyDir, "changed.com.txt.gz")); !os.IsNotExist(err) {
+		t.Errorf("stale compressed copy of the changed file kept: %v", err)
+	}
+}
+
+// historyRecorder is an Output that only records the history files it gets
+type historyRecorder struct {
+	fileOutput
+	files []string
+}
+
+func (r *historyRecorder) WriteHistoryFile(program, platform, domainDir, relPath string, fqdns []string) error {
+	r.files = append(r.files, relPath)
+	return nil
+}
+
+func TestMergeHistoryWritesThroughOutput(t *testing.T) {
+	setOpts(t, nil)
+	recorder := &historyRecorder{}
+	defer func(previous Output) { output = previous }(output)
+	output = recorder
+
+	historyDir := t.TempDir()
+	writeFile(t, filepath.Join(historyDir, "old.com.txt"), "a.old.com\n")
+	newDir := t.TempDir()
+	writeFile(t, filepath.Join(newDir, "old.com.txt"), "b.old.com\n")
+	writeFile(t, filepath.Join(newDir, "new.com.txt"), "a.new.com\n")
+
+	written, err := mergeHistory(newDir, historyDir, "Acme", "hackerone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(recorder.files)
+	if written != 2 || !slices.Equal(recorder.files, []string{"new.com.txt", "old.com.txt"}) {
+		t.Errorf("written %d, output got %q, want both files", written, recorder.files)
+	}
+	if _, err := os.Stat(filepath.Join(historyDir, "new.com.txt")); !os.IsNotExist(err) {
+		t.Errorf("new file was moved past the output: %v", err)
+	}
+}
+
+// TestProcessIncrementalMetadataHeader checks that a rerun with
+// -metadata-header leaves unchanged history files alone
+func TestProcessIncrementalMetadataHeader(t *testing.T) {
+	setOpts(t, func(o *options) {
+		o.incrementalHistory = true
+		o.metadataHeader = true
+	})
+	inTempDir(t)
+	srv := zipServer(t, makeZip(t, map[string]string{"example.com.txt": "a.example.com\n"}))
+	entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+	path := filepath.Join("hackerone", "Domains", "Acme", "example.com.txt")
+
+	if result := newTestProcessor([]Entry{entry}).process(entry); !result.Success {
+		t.Fatalf("first run failed: %v", result.Err)
+	}
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if result := newTestProcessor([]Entry{entry}).process(entry); !result.Success {
+		t.Fatalf("second run failed: %v", result.Err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("unchanged history file was rewritten at %s", info.ModTime())
+	}
+	content, _ := os.ReadFile(path)
+	if lines, err := readLines(path); err != nil || len(lines) != 1 || content[0] != '#' {
+		t.Errorf("history file = %q, %v, want the header and one FQDN", content, err)
+	}
+}
+
+// TestProcessAdditiveSeenFromFeed checks that FQDNs -additive keeps in the
+// history after they dropped out of the feed are no longer seen
+func TestProcessAdditiveSeenFromFeed(t *testing.T) {
+	setOpts(t, func(o *options) {
+		o.additive = true
+		o.pruneDeadAfter = time.Hour
+	})
+	inTempDir(t)
+	first := zipServer(t, makeZip(t, map[string]string{"example.com.txt": "a.example.com\nb.example.com\n"}))
+	second := zipServer(t, makeZip(t, map[string]string{"example.com.txt": "a.example.com\n"}))
+
+	entry := Entry{Name: "Acme", URL: first.URL + "/acme.zip", Platform: "hackerone"}
+	if result := newTestProcessor([]Entry{entry}).process(entry); !result.Success {
+		t.Fatalf("first run failed: %v", result.Err)
+	}
+	entry.URL = second.URL + "/acme.zip"
+	result := newTestProcessor([]Entry{entry}).process(entry)
+	if !result.Success {
+		t.Fatalf("second run failed: %v", result.Err)
+	}
+
+	if !slices.Equal(result.seen, []string{"a.example.com"}) {
+		t.Errorf("seen = %q, want only the FQDN still in the feed", result.seen)
+	}
+	lines, _ := readLines(filepath.Join("hackerone", "Domains", "Acme", "example.com.txt"))
+	if len(lines) != 2 {
+		t.Errorf("history = %q, want both FQDNs kept", lines)
+	}
+}
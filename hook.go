@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// hookRunner runs the -post-program-cmd in the background with a bounded
+// number of commands at the same time
+type hookRunner struct {
+	command string
+	sem     chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newHookRunner(command string, concurrency int) *hookRunner {
+	return &hookRunner{command: command, sem: make(chan struct{}, concurrency)}
+}
+
+// run starts the command for a finished program. The details are passed in
+// CHAOS_* environment variables, a failing command is only reported.
+func (h *hookRunner) run(program, platform, domainDir, updateDir string, newFQDNs int) {
+	env := append(os.Environ(),
+		"CHAOS_PROGRAM="+program,
+		"CHAOS_PLATFORM="+platform,
+		"CHAOS_DOMAIN_DIR="+absPath(domainDir),
+		"CHAOS_UPDATE_DIR="+absPath(updateDir),
+		"CHAOS_NEW_FQDNS="+strconv.Itoa(newFQDNs),
+	)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.sem <- struct{}{}
+		defer func() { <-h.sem }()
+
+		cmd := shellCommand(h.command)
+		cmd.Env = env
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(output.String()); msg != "" {
+				printWarning("Post-program command failed for '%s' [%s]: %v: %s", program, platform, err, msg)
+			} else {
+				printWarning("Post-program command failed for '%s' [%s]: %v", program, platform, err)
+			}
+		}
+	}()
+}
+
+// wait blocks until all started commands finished
+func (h *hookRunner) wait() {
+	h.wg.Wait()
+}
+
+// absPath returns path as absolute path, an empty path stays empty
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// hostAllowed reports whether the download URL points to one of the
+// -allowed-hosts or a subdomain of one
+func hostAllowed(rawURL string, allowed []string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL, false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, a := range allowed {
+		if host == a || strings.HasSuffix(host, "."+a) {
+			return host, true
+		}
+	}
+	return host, false
+}
+
+// checkDownloadHosts warns about entries whose download URL is not on the
+// -allowed-hosts. With -strict-host they are left out of the returned entries.
+func checkDownloadHosts(entries []Entry, allowed []string, strict bool) []Entry {
+	var kept []Entry
+	for _, entry := range entries {
+		host, ok := hostAllowed(entry.URL, allowed)
+		if !ok {
+			fields := []any{"program", entry.Name, "platform", entry.Platform, "url", entry.URL, "host", host, "skipped", strict}
+			if strict {
+				printWarningEvent(fields, "Skipping '%s' [%s], download host '%s' is not allowed", entry.Name, entry.Platform, host)
+				continue
+			}
+			printWarningEvent(fields, "Download host '%s' of '%s' [%s] is not on -allowed-hosts", host, entry.Name, entry.Platform)
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// httpClient is shared by the index fetch and all downloads
+var httpClient = http.DefaultClient
+
+// downloadProxies rotates the zip downloads over -proxy-list, nil without one
+var downloadProxies *proxyPool
+
+// indexAuthorization is the Authorization header from -index-auth-bearer or
+// -index-auth-basic. It is only sent to the private hosts in indexAuthHosts,
+// never to the public chaos index.
+var (
+	indexAuthorization string
+	indexAuthHosts     = make(map[string]bool)
+)
+
+func initHTTP() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	httpClient = &http.Client{Transport: transport}
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		return err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if err := initIndexAuth(); err != nil {
+		return err
+	}
+
+	if opts.proxyList != "" {
+		pool, err := loadProxyPool(opts.proxyList, transport)
+		if err != nil {
+			return err
+		}
+		downloadProxies = pool
+		printInfo("Loaded %d proxies from '%s'", len(pool.clients), opts.proxyList)
+	}
+	return nil
+}
+
+// loadTLSConfig builds the TLS settings from -ca-cert, -insecure and
+// -tls-servername, nil keeps the defaults
+func loadTLSConfig() (*tls.Config, error) {
+	if opts.caCert == "" && !opts.insecure && opts.tlsServerName == "" {
+		return nil, nil
+	}
+	// ServerName is checked against the certificate instead of the host
+	// connected to, e.g. an internal mirror serving the cert of the CDN
+	config := &tls.Config{ServerName: opts.tlsServerName}
+	if opts.caCert != "" {
+		pem, err := os.ReadFile(opts.caCert)
+		if err != nil {
+			return nil, err
+		}
+		// Keep trusting the system roots, the bundle usually only adds the proxy CA
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in '%s'", opts.caCert)
+		}
+		config.RootCAs = pool
+	}
+	if opts.insecure {
+		printWarning("TLS certificate verification is DISABLED (-insecure), downloads can be intercepted and tampered with")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+// gzipMagic starts every gzip stream, zip archives start with "PK" instead
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// httpGet requests url and asks for gzip explicitly. This disables the
+// transparent decompression of the transport, which fails on zip archives
+// wrongly labelled as gzip, in favour of responseBody.
+func httpGet(client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	if auth := authorizationFor(req.URL); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return client.Do(req)
+}
+
+// authorizationFor returns the Authorization header for a request to u, ""
+// for every host the credentials weren't given for
+func authorizationFor(u *url.URL) string {
+	if indexAuthorization == "" || !indexAuthHosts[strings.ToLower(u.Host)] {
+		return ""
+	}
+	return indexAuthorization
+}
+
+func initIndexAuth() error {
+	switch {
+	case opts.indexAuthBearer != "" && opts.indexAuthBasic != "":
+		return errors.New("-index-auth-bearer and -index-auth-basic can't be combined")
+	case opts.indexAuthBearer != "":
+		indexAuthorization = "Bearer " + opts.indexAuthBearer
+	case opts.indexAuthBasic != "":
+		if !strings.Contains(opts.indexAuthBasic, ":") {
+			return errors.New("-index-auth-basic must be given as user:pass")
+		}
+		indexAuthorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(opts.indexAuthBasic))
+	default:
+		return nil
+	}
+
+	hosts, err := indexAuthTargets(opts.indexAuthHost, opts.indexSources)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		indexAuthHosts[host] = true
+	}
+	return nil
+}
+
+// indexAuthTargets returns the hosts the index credentials are sent to: the
+// -index-auth-host list if given, else the hosts of the -index sources. The
+// public chaos index is never one of them, its zip downloads must not carry
+// the token of a private feed merged alongside.
+func indexAuthTargets(authHosts string, sources []string) ([]string, error) {
+	public, _ := url.Parse(indexURL)
+	var hosts []string
+	if authHosts != "" {
+		for _, host := range strings.Split(authHosts, ",") {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host == "" {
+				continue
+			}
+			if host == public.Host {
+				return nil, fmt.Errorf("-index-auth-host must not be the public chaos index '%s'", public.Host)
+			}
+			hosts = append(hosts, host)
+		}
+	} else {
+		for _, source := range sources {
+			u, err := url.Parse(source)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			if host := strings.ToLower(u.Host); host != public.Host {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("-index-auth-bearer and -index-auth-basic need a private http(s) -index source or -index-auth-host, they are never sent to the public chaos index")
+	}
+	return hosts, nil
+}
+
+// responseBody returns the decoded body of resp. A body is gzip when the
+// headers say so, either as Content-Encoding or as a gzip file (Content-Type
+// or a .gz path, e.g. index.json.gz). Payloads that are labelled gzip but
+// aren't (e.g. a zip archive served with the wrong header) are passed
+// through unchanged.
+func responseBody(resp *http.Response) (io.ReadCloser, error) {
+	if resp.Uncompressed || !gzipLabelled(resp) {
+		return resp.Body, nil
+	}
+
+	br := bufio.NewReader(resp.Body)
+	magic, _ := br.Peek(len(gzipMagic))
+	if string(magic) != string(gzipMagic) {
+		return readCloser{br, resp.Body}, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{gz, resp.Body}, nil
+}
+
+// gzipLabelled reports whether the headers or the path of resp declare a
+// gzip body
+func gzipLabelled(resp *http.Response) bool {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return true
+	}
+	mediaType, _, _ := strings.Cut(strings.ToLower(resp.Header.Get("Content-Type")), ";")
+	switch strings.TrimSpace(mediaType) {
+	case "application/gzip", "application/x-gzip":
+		return true
+	}
+	return resp.Request != nil && strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".gz")
+}
+
+// readCloser reads from a wrapping reader but closes the underlying body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// proxyPool hands out one client per proxy in round-robin order
+type proxyPool struct {
+	mu      sync.Mutex
+	next    int
+	proxies []string
+	clients []*http.Client
+}
+
+// loadProxyPool reads one proxy URL per line from path, empty lines and
+// lines starting with # are ignored. Every proxy gets its own transport
+// derived from base.
+func loadProxyPool(path string, base *http.Transport) (*proxyPool, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := &proxyPool{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxyURL, err := url.Parse(line)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy '%s'", line)
+		}
+		transport := base.Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		pool.proxies = append(pool.proxies, proxyURL.Redacted())
+		pool.clients = append(pool.clients, &http.Client{Transport: transport})
+	}
+	if len(pool.clients) == 0 {
+		return nil, fmt.Errorf("no proxies in '%s'", path)
+	}
+	return pool, nil
+}
+
+// download fetches url through the next proxy and moves on to the following
+// ones when a proxy fails, until every proxy was tried once
+func (p *proxyPool) download(url string) (*zipArchive, error) {
+	p.mu.Lock()
+	start := p.next
+	p.next = (p.next + 1) % len(p.clients)
+	p.mu.Unlock()
+
+	var err error
+	for i := 0; i < len(p.clients); i++ {
+		n := (start + i) % len(p.clients)
+		var data *zipArchive
+		data, err = downloadWithClient(p.clients[n], url)
+		if err == nil || !isProxyError(err) {
+			return data, err
+		}
+		printWarning("Proxy %s failed: %v", p.proxies[n], err)
+	}
+	return nil, err
+}
+
+// errProxyAuth marks a 407 response, the proxy rejected the request
+var errProxyAuth = errors.New("proxy authentication required")
+
+// isProxyError reports whether err is a connection level failure, which
+// makes trying the download through another proxy worthwhile
+func isProxyError(err error) bool {
+	var urlErr *url.Error
+	return errors.Is(err, errProxyAuth) || errors.As(err, &urlErr)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// resetIndexAuth clears the credentials initIndexAuth sets up
+func resetIndexAuth(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		indexAuthorization = ""
+		indexAuthHosts = make(map[string]bool)
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// authServer records the Authorization header of the last request
+func authServer(t *testing.T) (*httptest.Server, *string) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestIndexAuthOnlyForPrivateSource(t *testing.T) {
+	private, privateAuth := authServer(t)
+	other, otherAuth := authServer(t)
+	setOpts(t, func(o *options) {
+		o.indexAuthBearer = "secret"
+		// The private feed merged alongside the public one
+		o.indexSources = stringList{indexURL, private.URL + "/index.json"}
+	})
+	resetIndexAuth(t)
+	if err := initIndexAuth(); err != nil {
+		t.Fatal(err)
+	}
+
+	public, _ := url.Parse(indexURL)
+	if auth := authorizationFor(public); auth != "" {
+		t.Errorf("public chaos index gets Authorization %q", auth)
+	}
+	zip, _ := url.Parse("https://chaos-data.projectdiscovery.io/acme.zip")
+	if auth := authorizationFor(zip); auth != "" {
+		t.Errorf("public zip download gets Authorization %q", auth)
+	}
+
+	for _, target := range []string{private.URL + "/index.json", other.URL + "/a.zip"} {
+		resp, err := httpGet(http.DefaultClient, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if *privateAuth != "Bearer secret" {
+		t.Errorf("private source got Authorization %q, want the bearer token", *privateAuth)
+	}
+	if *otherAuth != "" {
+		t.Errorf("other host got Authorization %q", *otherAuth)
+	}
+}
+
+func TestIndexAuthRejectsPublicIndex(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		authHosts string
+		sources   []string
+	}{
+		{"default index only", "", []string{indexURL}},
+		{"public auth host", "chaos-data.projectdiscovery.io", []string{indexURL}},
+		{"file source", "", []string{"index.json"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if hosts, err := indexAuthTargets(tc.authHosts, tc.sources); err == nil {
+				t.Errorf("got hosts %v, want an error", hosts)
+			}
+		})
+	}
+
+	hosts, err := indexAuthTargets(" Feed.Example.com ,", []string{indexURL})
+	if err != nil || len(hosts) != 1 || hosts[0] != "feed.example.com" {
+		t.Errorf("got %v, %v, want [feed.example.com]", hosts, err)
+	}
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchIndexGzip(t *testing.T) {
+	setOpts(t, nil)
+	index := []byte(`[{"name":"Acme","URL":"https://example.com/acme.zip","count":3,"platform":"hackerone"}]`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/encoded/index.json":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Type", "application/json")
+		case "/raw/index.json.gz":
+			// A gzip file, only the path says so
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/typed/index":
+			w.Header().Set("Content-Type", "application/gzip")
+		default:
+			w.Write(index)
+			return
+		}
+		w.Write(gzipData(t, index))
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, path := range []string{"/encoded/index.json", "/raw/index.json.gz", "/typed/index", "/plain/index.json"} {
+		t.Run(path, func(t *testing.T) {
+			entries, _, err := fetchIndex(srv.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name != "Acme" || entries[0].Count != 3 {
+				t.Errorf("got %+v", entries)
+			}
+		})
+	}
+}
+
+func TestResponseBodyMislabelledZip(t *testing.T) {
+	archive := makeZip(t, map[string]string{"example.com.txt": "a.example.com\n"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := httpGet(http.DefaultClient, srv.URL+"/acme.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := responseBody(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(body)
+	if err != nil || !bytes.Equal(got, archive) {
+		t.Errorf("mislabelled zip was altered: %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// idnProfile converts between Unicode and punycode without rejecting names
+// the feed commonly contains, like wildcards or underscores
+var idnProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// normalizeFQDN returns line in the canonical form chosen by -output-encoding.
+// Lines that can't be converted are returned unchanged.
+func normalizeFQDN(line string) string {
+	if hasControl(line) {
+		return line
+	}
+	switch opts.outputEncoding {
+	case "punycode":
+		if isASCII(line) {
+			return line
+		}
+		if ascii, err := idnProfile.ToASCII(line); err == nil {
+			return ascii
+		}
+	case "unicode":
+		if !strings.Contains(strings.ToLower(line), "xn--") {
+			return line
+		}
+		// the lenient profile decodes broken labels like a bare "xn--" to
+		// something else entirely, so only keep results that map back
+		decoded, err := idnProfile.ToUnicode(line)
+		if err != nil {
+			return line
+		}
+		if ascii, err := idnProfile.ToASCII(decoded); err == nil && ascii == strings.ToLower(line) {
+			return decoded
+		}
+	}
+	return line
+}
+
+func normalizeFQDNs(lines []string) []string {
+	if opts.outputEncoding == "none" {
+		return lines
+	}
+	for i, line := range lines {
+		lines[i] = normalizeFQDN(line)
+	}
+	return lines
+}
+
+// normalizeFile rewrites the extracted file at path in the canonical encoding
+func normalizeFile(path string) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i, line := range lines {
+		if normalized := normalizeFQDN(line); normalized != line {
+			lines[i] = normalized
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeLines(path, lines)
+}
+
+// hasControl reports whether s contains whitespace or control characters,
+// which no hostname does
+func hasControl(s string) bool {
+	for _, r := range s {
+		if r <= ' ' || r == 0x7f || unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var idnTests = []struct {
+	name     string
+	unicode  string
+	punycode string
+}{
+	{"single label", "bücher.example.com", "xn--bcher-kva.example.com"},
+	{"subdomain", "shop.münchen.de", "shop.xn--mnchen-3ya.de"},
+	{"every label", "пример.испытание", "xn--e1afmkfd.xn--80akhbyknj4f"},
+	{"wildcard", "*.bücher.example.com", "*.xn--bcher-kva.example.com"},
+	{"underscore", "_dmarc.bücher.example.com", "_dmarc.xn--bcher-kva.example.com"},
+}
+
+func TestNormalizeFQDNRoundTrip(t *testing.T) {
+	for _, tc := range idnTests {
+		t.Run(tc.name, func(t *testing.T) {
+			setOpts(t, func(o *options) { o.outputEncoding = "punycode" })
+			ascii := normalizeFQDN(tc.unicode)
+			if ascii != tc.punycode {
+				t.Fatalf("punycode(%q) = %q, want %q", tc.unicode, ascii, tc.punycode)
+			}
+			if again := normalizeFQDN(ascii); again != ascii {
+				t.Errorf("punycode(%q) = %q, want it unchanged", ascii, again)
+			}
+
+			opts.outputEncoding = "unicode"
+			if back := normalizeFQDN(ascii); back != tc.unicode {
+				t.Errorf("unicode(%q) = %q, want %q", ascii, back, tc.unicode)
+			}
+			if again := normalizeFQDN(tc.unicode); again != tc.unicode {
+				t.Errorf("unicode(%q) = %q, want it unchanged", tc.unicode, again)
+			}
+		})
+	}
+}
+
+func TestNormalizeFQDNMixedCase(t *testing.T) {
+	setOpts(t, func(o *options) { o.outputEncoding = "punycode" })
+	for _, name := range []string{"BÜCHER.example.com", "Bücher.Example.com", "bÜcHeR.EXAMPLE.COM"} {
+		if got := normalizeFQDN(name); got != "xn--bcher-kva.example.com" {
+			t.Errorf("punycode(%q) = %q, want xn--bcher-kva.example.com", name, got)
+		}
+	}
+
+	opts.outputEncoding = "unicode"
+	for _, name := range []string{"XN--BCHER-KVA.example.com", "Xn--Bcher-Kva.Example.com"} {
+		if got := normalizeFQDN(name); got != "bücher.example.com" {
+			t.Errorf("unicode(%q) = %q, want bücher.example.com", name, got)
+		}
+	}
+}
+
+func TestNormalizeFQDNInvalidLabels(t *testing.T) {
+	invalid := []string{
+		"xn--.example.com",
+		"xn--a.example.com",
+		"xn--bcher-kva-!.example.com",
+		"a‍.example.com",
+		"bücher\u0000.example.com",
+	}
+	for _, encoding := range []string{"punycode", "unicode"} {
+		setOpts(t, func(o *options) { o.outputEncoding = encoding })
+		for _, name := range invalid {
+			if got := normalizeFQDN(name); got != name {
+				t.Errorf("%s(%q) = %q, want it unchanged", encoding, name, got)
+			}
+		}
+	}
+}
+
+func TestNormalizeFile(t *testing.T) {
+	setOpts(t, func(o *options) { o.outputEncoding = "punycode" })
+	path := filepath.Join(t.TempDir(), "acme.txt")
+	writeFile(t, path, "# program=acme\nBücher.example.com\nplain.example.com\nxn--.example.com\n")
+
+	if err := normalizeFile(path); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "xn--bcher-kva.example.com|plain.example.com|xn--.example.com"
+	if got := strings.Join(lines, "|"); got != want {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
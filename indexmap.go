@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// entryKeys maps the lower-cased field names and JSON keys of Entry to the JSON key
+func entryKeys() map[string]string {
+	keys := make(map[string]string)
+	t := reflect.TypeOf(Entry{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		keys[strings.ToLower(field.Name)] = tag
+		keys[strings.ToLower(tag)] = tag
+	}
+	return keys
+}
+
+// parseIndexFieldMap parses -index-field-map, e.g. "download_url=URL,org=Name",
+// into feed key -> Entry JSON key
+func parseIndexFieldMap(value string) (map[string]string, error) {
+	keys := entryKeys()
+	mapping := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("invalid mapping '%s', expected feed_key=Field", part)
+		}
+		key, known := keys[strings.ToLower(to)]
+		if !known {
+			return nil, fmt.Errorf("unknown index field '%s'", to)
+		}
+		mapping[from] = key
+	}
+	return mapping, nil
+}
+
+// remapEntries decodes an index whose keys differ from the chaos index by
+// renaming them according to mapping before decoding into Entry
+func remapEntries(data []byte, mapping map[string]string) ([]Entry, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	for _, object := range raw {
+		for from, to := range mapping {
+			if value, ok := object[from]; ok {
+				delete(object, from)
+				object[to] = value
+			}
+		}
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// keepZip saves the downloaded archive of a program for -keep-zips as
+// <dir>/<platform>/<program>_<date>.zip. Nothing is written when the newest
+// saved archive of the program has the same hash. It returns the path
+// written, or "" if the archive was already kept.
+func keepZip(archive *zipArchive, dir, platform, name string) (string, error) {
+	programDir := filepath.Join(dir, platform)
+	hash, err := archive.hash(opts.hashAlgo)
+	if err != nil {
+		return "", err
+	}
+	if latest := latestKeptZip(programDir, name); latest != "" {
+		if kept, err := hashFile(latest, opts.hashAlgo); err == nil && kept == hash {
+			return "", nil
+		}
+	}
+
+	path := filepath.Join(programDir, name+"_"+time.Now().Format("2006-01-02")+".zip")
+	if err := os.MkdirAll(programDir, 0755); err != nil {
+		return "", err
+	}
+	tmpPath := path + ".part"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	err = archive.copyTo(out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return path, nil
+}
+
+// latestKeptZip returns the newest archive of the program saved in dir, the
+// dates in the names sort chronologically
+func latestKeptZip(dir, name string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, name+"_*.zip"))
+	var kept []string
+	for _, match := range matches {
+		date := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), name+"_"), ".zip")
+		if _, err := time.Parse("2006-01-02", date); err == nil {
+			kept = append(kept, match)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	sort.Strings(kept)
+	return kept[len(kept)-1]
+}
+
+// copyTo writes the raw archive to w
+func (a *zipArchive) copyTo(w io.Writer) error {
+	if a.path == "" {
+		_, err := w.Write(a.data)
+		return err
+	}
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// hash returns the hex digest of the raw archive with algo
+func (a *zipArchive) hash(algo string) (string, error) {
+	h := hashAlgos[algo]()
+	if a.path == "" {
+		h.Write(a.data)
+	} else if err := a.copyTo(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openLocalArchive reads a file:// URL of an index entry, e.g. an archive
+// saved by -keep-zips, so a local index can be reprocessed offline
+func openLocalArchive(path string) (*zipArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readArchive(f, opts.spoolThreshold)
+}
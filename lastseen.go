@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const lastSeenFile = "last_seen.json"
+
+// lastSeen maps every program (platform/name as in manifest.json) to the
+// time each of its FQDNs was last part of the feed
+type lastSeen map[string]map[string]time.Time
+
+func loadLastSeen(path string) (lastSeen, error) {
+	seen := make(lastSeen)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return seen, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &seen); err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+func (s lastSeen) update(program string, fqdns []string, now time.Time) {
+	if s[program] == nil {
+		s[program] = make(map[string]time.Time)
+	}
+	for _, fqdn := range fqdns {
+		s[program][fqdn] = now
+	}
+}
+
+// stale returns the FQDNs of program not seen since before cutoff, sorted
+func (s lastSeen) stale(program string, cutoff time.Time) []string {
+	var fqdns []string
+	for fqdn, seenAt := range s[program] {
+		if seenAt.Before(cutoff) {
+			fqdns = append(fqdns, fqdn)
+		}
+	}
+	sort.Strings(fqdns)
+	return fqdns
+}
+
+func (s lastSeen) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// collectFQDNs returns the lines of all files below dir
+func collectFQDNs(dir string) []string {
+	var fqdns []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err == nil {
+			fqdns = append(fqdns, lines...)
+		}
+		return nil
+	})
+	return fqdns
+}
+
+// printDeadFQDNs reports the FQDNs per program that dropped out of the feed
+func printDeadFQDNs(dead map[string][]string, after time.Duration) {
+	if len(dead) == 0 {
+		return
+	}
+	programs := make([]string, 0, len(dead))
+	total := 0
+	for program, fqdns := range dead {
+		programs = append(programs, program)
+		total += len(fqdns)
+	}
+	sort.Strings(programs)
+
+	printHeader("%d FQDNs not seen for more than %s:", total, after)
+	for _, program := range programs {
+		printEvent([]any{"program_dir", program, "dead_fqdns", len(dead[program])}, "%s: %d FQDNs", program, len(dead[program]))
+		for _, fqdn := range dead[program] {
+			printInfo("  - %s", fqdn)
+		}
+	}
+}
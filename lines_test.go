@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// lineTests pin the line and comment rules shared by readLines and all line
+// counters
+var lineTests = []struct {
+	name  string
+	input string
+	want  []string
+}{
+	{"empty", "", nil},
+	{"one line", "a.example.com\n", []string{"a.example.com"}},
+	{"no trailing newline", "a.example.com\nb.example.com", []string{"a.example.com", "b.example.com"}},
+	{"empty line", "a.example.com\n\nb.example.com\n", []string{"a.example.com", "", "b.example.com"}},
+	{"crlf", "a.example.com\r\nb.example.com\r\n", []string{"a.example.com", "b.example.com"}},
+	{"header", "# program=acme platform=hackerone\na.example.com\n", []string{"a.example.com"}},
+	{"comment without newline", "a.example.com\n#end", []string{"a.example.com"}},
+	{"indented comment", " #x\n\t# note\na.example.com\n", []string{"a.example.com"}},
+	{"crlf comment", "\r# note\r\na.example.com\r\n", []string{"a.example.com"}},
+	{"hash inside line", "a.example.com#frag\n", []string{"a.example.com#frag"}},
+	{"blank line", "   \na.example.com\n", []string{"", "a.example.com"}},
+	{"only comments", "#a\n#b\n", nil},
+}
+
+func TestLineRules(t *testing.T) {
+	setOpts(t, func(o *options) { o.readBufferSize = 16 })
+	dir := t.TempDir()
+	for i, tc := range lineTests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.Repeat("f", i+1)+".txt")
+			if err := os.WriteFile(path, []byte(tc.input), 0644); err != nil {
+				t.Fatal(err)
+			}
+			want := len(tc.want)
+
+			lines, err := readLines(path)
+			if err != nil || strings.Join(lines, "|") != strings.Join(tc.want, "|") || len(lines) != want {
+				t.Errorf("readLines = %q, %v, want %q", lines, err, tc.want)
+			}
+			if got, err := countLines(path); err != nil || got != want {
+				t.Errorf("countLines = %d, %v, want %d", got, err, want)
+			}
+			if got, err := countReaderLines(iotest.OneByteReader(strings.NewReader(tc.input))); err != nil || got != want {
+				t.Errorf("countReaderLines = %d, %v, want %d", got, err, want)
+			}
+			if got, err := countMappedLines(path); err == nil && got != want {
+				t.Errorf("countMappedLines = %d, want %d", got, want)
+			}
+
+			var whole lineCounter
+			whole.Write([]byte(tc.input))
+			if got := whole.count(); got != want {
+				t.Errorf("lineCounter in one write = %d, want %d", got, want)
+			}
+			var split lineCounter
+			for _, b := range []byte(tc.input) {
+				split.Write([]byte{b})
+			}
+			if got := split.count(); got != want {
+				t.Errorf("lineCounter byte by byte = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestCountLinesLongLine(t *testing.T) {
+	setOpts(t, func(o *options) { o.readBufferSize = 16 })
+	input := strings.Repeat(" ", 100) + "#" + strings.Repeat("x", 100) + "\n" + strings.Repeat("a", 100)
+	if got, err := countReaderLines(bytes.NewReader([]byte(input))); err != nil || got != 1 {
+		t.Errorf("countReaderLines = %d, %v, want 1", got, err)
+	}
+}
+
+// BenchmarkCountLines compares reading a large history file through the read
+// buffer with counting it through a memory mapping
+func BenchmarkCountLines(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "acme.txt")
+	var buf bytes.Buffer
+	buf.WriteString("# program=acme platform=hackerone\n")
+	for i := 0; buf.Len() < 64<<20; i++ {
+		fmt.Fprintf(&buf, "host-%d.api.example.com\n", i)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		b.Fatal(err)
+	}
+	want, err := countLines(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name      string
+		threshold int64
+	}{
+		{"read", 0},
+		{"mmap", 1},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			setOpts(b, func(o *options) { o.mmapThreshold = bc.threshold })
+			if bc.threshold > 0 {
+				if _, err := countMappedLines(path); err != nil {
+					b.Skipf("mmap unavailable: %v", err)
+				}
+			}
+			b.SetBytes(int64(buf.Len()))
+			b.ResetTimer()
+			for range b.N {
+				if got, err := countLines(path); err != nil || got != want {
+					b.Fatalf("countLines = %d, %v, want %d", got, err, want)
+				}
+			}
+		})
+	}
+}
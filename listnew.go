@@ -0,0 +1,19 @@
+package main
+
+// listNewPrograms prints the entries the index marks as new to the feed
+func listNewPrograms(entries []Entry) {
+	var newEntries []Entry
+	for _, entry := range entries {
+		if entry.IsNew {
+			newEntries = append(newEntries, entry)
+		}
+	}
+	sortEntries(newEntries, "platform")
+
+	printHeader("%-40s %-15s %8s  %s", "Program", "Platform", "FQDNs", "Program URL")
+	printSeparator()
+	for _, entry := range newEntries {
+		printStats("%-40s %-15s %8d  %s", entry.Name, entryPlatform(entry), entry.Count, entry.ProgramURL)
+	}
+	printInfo("%d of %d programs are new", len(newEntries), len(entries))
+}
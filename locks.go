@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// dirLocks serializes the programs working on the same directory. Two index
+// entries can map to the same Domains/<program> tree, e.g. a program listed
+// twice or names that only differ in characters sanitizeName drops, and the
+// dated Updates_<date> directory is shared by all programs of a platform.
+var dirLocks = &keyedLocks{locks: make(map[string]*sync.RWMutex)}
+
+// keyedLocks hands out one RWMutex per cleaned path. Locks are never freed,
+// there are at most a few per program of the run.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+func (k *keyedLocks) get(path string) *sync.RWMutex {
+	key := filepath.Clean(path)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l := k.locks[key]
+	if l == nil {
+		l = &sync.RWMutex{}
+		k.locks[key] = l
+	}
+	return l
+}
+
+// lock takes path exclusively and returns the unlock function
+func (k *keyedLocks) lock(path string) func() {
+	l := k.get(path)
+	l.Lock()
+	return l.Unlock
+}
+
+// rlock takes path shared with other readers and returns the unlock function
+func (k *keyedLocks) rlock(path string) func() {
+	l := k.get(path)
+	l.RLock()
+	return l.RUnlock
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
-	"archive/zip"
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -31,29 +43,556 @@ const (
 	colorBold   = "\033[1m"
 )
 
+// jsonLogger replaces the colored output when -json-logs is set
+var jsonLogger *slog.Logger
+
+// logOutput receives all log lines. It is stderr in -stream mode and when the
+// -report-format summary goes to stdout, where stdout carries the data.
+var logOutput io.Writer = os.Stdout
+
+// logProgram and logPlatform are attached to every JSON log line while a program is processed
+var (
+	logProgram, logPlatform string
+	logMu                   sync.Mutex
+)
+
+func initLogging() {
+	if opts.stream || (opts.reportFormat != "text" && opts.reportFile == "") {
+		logOutput = os.Stderr
+	}
+	if opts.jsonLogs {
+		jsonLogger = slog.New(slog.NewJSONHandler(logOutput, nil))
+	}
+}
+
+// setLogProgram sets the program context of the log. With -concurrency above
+// 1 several programs run at once, the context is then left empty rather
+// than attributing lines to the wrong program.
+func setLogProgram(program, platform string) {
+	if opts.concurrency > 1 {
+		return
+	}
+	logMu.Lock()
+	logProgram, logPlatform = program, platform
+	logMu.Unlock()
+}
+
+func logJSON(level slog.Level, msg string, fields ...any) {
+	logMu.Lock()
+	program, platform := logProgram, logPlatform
+	logMu.Unlock()
+	if program != "" {
+		fields = append(fields, "program", program, "platform", platform)
+	}
+	jsonLogger.Log(context.Background(), level, msg, fields...)
+}
+
 // Helper functions for colored output
+func printColored(color string, level slog.Level, format string, args ...interface{}) {
+	if jsonLogger != nil {
+		logJSON(level, fmt.Sprintf(format, args...))
+		return
+	}
+	fmt.Fprintf(logOutput, color+format+colorReset+"\n", args...)
+}
+
 func printInfo(format string, args ...interface{}) {
-	fmt.Printf(colorCyan+format+colorReset+"\n", args...)
+	printColored(colorCyan, slog.LevelInfo, format, args...)
 }
 
 func printSuccess(format string, args ...interface{}) {
-	fmt.Printf(colorGreen+format+colorReset+"\n", args...)
+	printColored(colorGreen, slog.LevelInfo, format, args...)
 }
 
 func printWarning(format string, args ...interface{}) {
-	fmt.Printf(colorYellow+format+colorReset+"\n", args...)
+	printColored(colorYellow, slog.LevelWarn, format, args...)
 }
 
 func printError(format string, args ...interface{}) {
-	fmt.Printf(colorRed+format+colorReset+"\n", args...)
+	printColored(colorRed, slog.LevelError, format, args...)
 }
 
 func printHeader(format string, args ...interface{}) {
-	fmt.Printf(colorBold+colorPurple+format+colorReset+"\n", args...)
+	printColored(colorBold+colorPurple, slog.LevelInfo, format, args...)
 }
 
 func printStats(format string, args ...interface{}) {
-	fmt.Printf(colorBlue+format+colorReset+"\n", args...)
+	printColored(colorBlue, slog.LevelInfo, format, args...)
+}
+
+// printEvent is printSuccess with additional key-value fields for -json-logs
+func printEvent(fields []any, format string, args ...interface{}) {
+	if jsonLogger != nil {
+		logJSON(slog.LevelInfo, fmt.Sprintf(format, args...), fields...)
+		return
+	}
+	printSuccess(format, args...)
+}
+
+// printWarningEvent is printWarning with additional key-value fields for -json-logs
+func printWarningEvent(fields []any, format string, args ...interface{}) {
+	if jsonLogger != nil {
+		logJSON(slog.LevelWarn, fmt.Sprintf(format, args...), fields...)
+		return
+	}
+	printWarning(format, args...)
+}
+
+// printSeparator draws a line in the colored output and is omitted from JSON logs
+func printSeparator() {
+	if jsonLogger == nil {
+		printHeader("──────────────────────────────")
+	}
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type options struct {
+	readBufferSize int
+	keepTemp       bool
+	indexSources   stringList
+	timingsFile    string
+	interactive    bool
+	jsonLogs       bool
+	zipUpdates     bool
+	onlyUpdated    bool
+	includeEmpty   bool
+
+	retries          int
+	retryBudget      int
+	breakerWindow    int
+	breakerThreshold float64
+	breakerBackoff   time.Duration
+	breakerMaxTrips  int
+
+	outputEncoding string
+	listUpdates    bool
+	sampleNew      int
+	hierarchical   bool
+	proxyList      string
+	statsJSON      string
+
+	indexAuthBearer string
+	indexAuthBasic  string
+	indexAuthHost   string
+
+	stream      bool
+	retryFailed bool
+
+	incrementalHistory bool
+
+	filterCmd         string
+	filterConcurrency int
+	filterTimeout     time.Duration
+
+	entriesJSON  string
+	noUpdatesDir bool
+	programsFile string
+
+	selfhostedName string
+	skipSelfhosted bool
+
+	fuzzyDedupe   bool
+	fuzzyPrefixes []string
+
+	splitBounty            bool
+	spoolThreshold         int64
+	dedupeReport           string
+	groupByApex            bool
+	ignoreWildcards        bool
+	keepWildcardHistory    bool
+	diffAgainst            string
+	caCert                 string
+	insecure               bool
+	maxRuntime             time.Duration
+	exportScope            string
+	pruneEmpty             bool
+	newProgramsFull        bool
+	checksums              bool
+	hashAlgo               string
+	verify                 bool
+	minChange              *int
+	nucleiTargets          string
+	nucleiScheme           string
+	pruneDeadAfter         time.Duration
+	healthcheck            bool
+	healthcheckMin         int
+	concurrency            int
+	platformConcurrency    map[string]int
+	sizeReport             int
+	resume                 bool
+	replaceExistingUpdates bool
+	compress               bool
+	compressAlgo           string
+	webhook                string
+	webhookOnError         bool
+	sortBy                 string
+	emitURLs               bool
+	urlScheme              string
+	urlPath                string
+	indexFieldMap          map[string]string
+	countReport            string
+	countTolerance         float64
+	singleFile             string
+	minFreeDisk            int64
+	verifyCRC              bool
+	listNew                bool
+	appendUpdates          bool
+	countConcurrency       int
+	publish                string
+	globalNewOnly          bool
+	postProgramCmd         string
+	postProgramConcurrency int
+	indexSchemaGuard       bool
+	mmapThreshold          int64
+	reportFormat           string
+	reportFile             string
+	fileMatch              *regexp.Regexp
+	allowedHosts           []string
+	strictHost             bool
+	additive               bool
+	progressJSON           bool
+	retryOnZipError        bool
+	patch                  bool
+	maxOpenFiles           int
+	tlsServerName          string
+	emitIndex              string
+	emitIndexURL           string
+	maxMemory              int64
+	countOnly              bool
+	metadataHeader         bool
+	countHistory           bool
+	countTrend             string
+	snapshots              int
+	since                  time.Duration
+	validateIndex          bool
+	keepZips               string
+	reportNewPerApex       bool
+	fromTemp               string
+
+	resolve             bool
+	resolverConcurrency int
+	resolverTimeout     time.Duration
+}
+
+var opts options
+
+func parseFlags() {
+	flag.IntVar(&opts.readBufferSize, "read-buffer", 32*1024, "read buffer size in bytes used when counting lines")
+	flag.BoolVar(&opts.keepTemp, "keep-temp", false, "keep extracted temp files and skip replacing the Domains history (for debugging)")
+	flag.Var(&opts.indexSources, "index", "index.json URL or file to process, can be repeated to merge several sources (default "+indexURL+")")
+	flag.StringVar(&opts.timingsFile, "timings", "", "write per-program download timings as CSV to this file and print the slowest downloads")
+	flag.BoolVar(&opts.interactive, "select", false, "interactively choose the programs to dump after fetching the index")
+	flag.BoolVar(&opts.jsonLogs, "json-logs", false, "write structured JSON log lines instead of colored text")
+	flag.BoolVar(&opts.zipUpdates, "zip-updates", false, "pack each Updates_<date> tree into a single zip at the end of the run")
+	flag.BoolVar(&opts.resolve, "resolve", false, "resolve new FQDNs and report how many of them have DNS records")
+	flag.IntVar(&opts.resolverConcurrency, "resolver-concurrency", 50, "maximum number of concurrent DNS lookups for -resolve")
+	flag.DurationVar(&opts.resolverTimeout, "resolver-timeout", 5*time.Second, "timeout of a single DNS lookup for -resolve")
+	flag.BoolVar(&opts.onlyUpdated, "only-updated", false, "leave the Domains history of programs without new FQDNs untouched")
+	flag.BoolVar(&opts.includeEmpty, "include-empty", false, "always create the Domains directory of programs without any domains and count them")
+	flag.IntVar(&opts.retries, "retries", 2, "number of retries for a failed download")
+	flag.IntVar(&opts.retryBudget, "retry-budget", 100, "maximum number of download retries for the whole run")
+	flag.IntVar(&opts.breakerWindow, "breaker-window", 20, "number of recent downloads the circuit breaker looks at, 0 disables it")
+	flag.Float64Var(&opts.breakerThreshold, "breaker-threshold", 50, "percentage of failed downloads within the window that trips the circuit breaker")
+	flag.DurationVar(&opts.breakerBackoff, "breaker-backoff", time.Minute, "pause after the circuit breaker tripped")
+	flag.IntVar(&opts.breakerMaxTrips, "breaker-max-trips", 3, "abort the run when the circuit breaker trips more often than this")
+	flag.StringVar(&opts.outputEncoding, "output-encoding", "none", "normalize internationalized domain names before diffing: none, punycode or unicode")
+	flag.BoolVar(&opts.listUpdates, "list-updates", false, "print a timeline of the existing Updates_<date> directories and exit")
+	flag.IntVar(&opts.sampleNew, "sample-new", -1, "instead of one log line per new or updated file, print at most this many new FQDNs per program (0 prints none, -1 keeps the per-file lines)")
+	flag.BoolVar(&opts.hierarchical, "hierarchical", false, "report new FQDNs grouped by their registered (apex) domain")
+	flag.StringVar(&opts.proxyList, "proxy-list", "", "file with one proxy URL per line, downloads rotate over them and fall back to the next proxy on failure")
+	flag.StringVar(&opts.statsJSON, "stats-json", "stats.json", "file the statistics are written to and compared against on the next run, empty disables it")
+	flag.StringVar(&opts.indexAuthBearer, "index-auth-bearer", "", "bearer token sent to the hosts of the private -index sources (and downloads from the same hosts), never to the public chaos index")
+	flag.StringVar(&opts.indexAuthBasic, "index-auth-basic", "", "user:pass for basic auth against the hosts of the private -index sources (and downloads from the same hosts), never to the public chaos index")
+	flag.StringVar(&opts.indexAuthHost, "index-auth-host", "", "comma separated hosts that get the -index-auth-* credentials instead of the hosts of the -index sources")
+	flag.BoolVar(&opts.stream, "stream", false, "write every program as a '# program platform' header followed by its FQDNs to stdout instead of to disk, logs go to stderr")
+	flag.BoolVar(&opts.retryFailed, "retry-failed", false, "only process the programs that failed in previous runs (listed in "+failedFile+")")
+	flag.BoolVar(&opts.incrementalHistory, "incremental-history", false, "only rewrite history files whose content changed instead of replacing the whole program directory")
+	flag.StringVar(&opts.filterCmd, "filter-cmd", "", "shell command that gets the FQDNs of each file on stdin, only the lines it prints are kept")
+	flag.IntVar(&opts.filterConcurrency, "filter-concurrency", 4, "maximum number of -filter-cmd processes running at the same time")
+	flag.DurationVar(&opts.filterTimeout, "filter-timeout", 5*time.Minute, "kill a -filter-cmd still running after this duration and fail the program (0 = no limit)")
+	flag.StringVar(&opts.entriesJSON, "entries-json", "", "write every processed index entry with the file, FQDN and new FQDN counts of this run as JSON to this file")
+	flag.BoolVar(&opts.noUpdatesDir, "no-updates-dir", false, "compute and report new FQDNs without writing the Updates_<date> trees, the Domains history is still updated")
+	flag.StringVar(&opts.programsFile, "programs-file", "", "only process the program names listed in this file, one per line, - reads them from stdin")
+	flag.StringVar(&opts.selfhostedName, "selfhosted-name", "selfhosted", "directory name used for index entries without a platform")
+	flag.BoolVar(&opts.skipSelfhosted, "skip-selfhosted", false, "skip index entries without a platform")
+	flag.BoolVar(&opts.fuzzyDedupe, "fuzzy-dedupe", false, "drop FQDNs that only differ from another FQDN of the same file by a prefix like www. or *.")
+	fuzzyPrefixes := flag.String("fuzzy-prefixes", "www.,*.", "comma separated prefixes collapsed by -fuzzy-dedupe")
+	flag.BoolVar(&opts.splitBounty, "split-bounty", false, "store bounty and non-bounty programs below separate bounty/ and vdp/ directories")
+	flag.Int64Var(&opts.spoolThreshold, "spool-threshold", 64<<20, "downloads larger than this many bytes are spooled to a temp file instead of memory (0 always spools, -1 never)")
+	flag.StringVar(&opts.dedupeReport, "dedupe-report", "", "write lines vs. distinct FQDNs per program as CSV to this file, most duplicated first")
+	flag.BoolVar(&opts.groupByApex, "group-by-apex", false, "write new FQDNs into one <apex>.txt per registered domain in the update directory")
+	flag.BoolVar(&opts.ignoreWildcards, "ignore-wildcards", false, "drop wildcard entries (*.example.com) so they never show up in updates or count as new FQDNs")
+	flag.BoolVar(&opts.keepWildcardHistory, "keep-wildcard-history", false, "with -ignore-wildcards keep the wildcard entries in the history")
+	flag.StringVar(&opts.diffAgainst, "diff-against", "", "compare against this baseline archive root instead of the current history, the baseline is not modified")
+	flag.StringVar(&opts.caCert, "ca-cert", "", "PEM bundle with additional CA certificates to trust, e.g. of a TLS-intercepting proxy")
+	flag.BoolVar(&opts.insecure, "insecure", false, "skip TLS certificate verification (dangerous)")
+	flag.DurationVar(&opts.maxRuntime, "max-runtime", 0, "stop picking up new programs after this duration, e.g. 45m (0 = no limit)")
+	flag.StringVar(&opts.exportScope, "export-scope", "", "write name, platform, program URL, bounty and domain directory of every dumped program to this file (CSV, or JSON for *.json)")
+	flag.BoolVar(&opts.pruneEmpty, "prune-empty", false, "remove empty files and directories from the history of every processed program")
+	flag.BoolVar(&opts.newProgramsFull, "only-new-programs-full", false, "take over all domains of programs the index marks as new without diffing, only existing programs are diffed")
+	flag.BoolVar(&opts.checksums, "checksums", false, "write a checksum of every domain file to <program>.checksums.txt next to the program directory")
+	flag.StringVar(&opts.hashAlgo, "hash-algo", "sha256", "hash algorithm for -checksums: sha256, blake3 or xxhash")
+	flag.BoolVar(&opts.verify, "verify", false, "verify all domain files against their checksums and exit")
+	minChange := flag.String("min-change", "", "only process programs whose change in the index is at least this value, negative values select shrinking programs")
+	flag.StringVar(&opts.nucleiTargets, "nuclei-targets", "", "write all new FQDNs of the run (only resolving ones with -resolve) deduplicated to this file for nuclei -list")
+	flag.StringVar(&opts.nucleiScheme, "nuclei-scheme", "", "scheme prepended to every -nuclei-targets line, e.g. https (default none)")
+	flag.DurationVar(&opts.pruneDeadAfter, "prune-dead-after", 0, "track when every FQDN was last seen in last_seen.json and report those missing from the feed for longer than this, e.g. 720h")
+	flag.BoolVar(&opts.healthcheck, "healthcheck", false, "only fetch and validate the index, exit with 1 if it looks broken")
+	flag.IntVar(&opts.healthcheckMin, "healthcheck-min", 100, "minimum number of index entries -healthcheck accepts")
+	flag.IntVar(&opts.concurrency, "concurrency", 1, "number of programs processed in parallel")
+	platformConcurrency := flag.String("platform-concurrency", "", "comma separated per-platform limits of parallel programs within -concurrency, e.g. hackerone=2,bugcrowd=8")
+	flag.IntVar(&opts.sizeReport, "size-report", 0, "after the run show the N programs of the archive using the most disk space and FQDNs")
+	flag.BoolVar(&opts.resume, "resume", false, "keep every download until its program is done and reuse the downloads of an interrupted run")
+	flag.BoolVar(&opts.replaceExistingUpdates, "replace-existing-updates", false, "on a rerun on the same day recompute the updates of the day instead of adding to them, updates of the earlier run still in the feed are kept")
+	flag.BoolVar(&opts.compress, "compress", false, "store the history compressed, the diff reads compressed and uncompressed files alike")
+	flag.StringVar(&opts.compressAlgo, "compress-algo", "gzip", "algorithm for -compress: gzip, zstd or brotli")
+	flag.StringVar(&opts.webhook, "webhook", "", "POST a JSON summary of the run with the statistics and failed programs to this URL")
+	flag.BoolVar(&opts.webhookOnError, "summary-webhook-on-error", false, "only send the -webhook summary if programs failed or the index couldn't be loaded")
+	flag.StringVar(&opts.sortBy, "sort", "platform", "order in which programs are processed: platform, name, count or index")
+	flag.BoolVar(&opts.emitURLs, "emit-urls", false, "write URLs instead of bare hosts to the update files and -stream")
+	flag.StringVar(&opts.urlScheme, "url-scheme", "https", "scheme of the -emit-urls URLs")
+	flag.StringVar(&opts.urlPath, "url-path", "", "path appended to the -emit-urls URLs, e.g. /robots.txt")
+	indexFieldMap := flag.String("index-field-map", "", "comma separated renames of index keys for feeds with a different schema, e.g. download_url=URL,org=Name")
+	flag.StringVar(&opts.countReport, "count-change-report", "", "write the index count and the dumped FQDNs of every program as CSV to this file and list large discrepancies")
+	flag.Float64Var(&opts.countTolerance, "count-tolerance", 10, "percentage by which -count-change-report tolerates the index count to differ")
+	flag.StringVar(&opts.singleFile, "single-file", "", "write the FQDNs of all processed programs sorted and deduplicated to this file instead of the directory layout")
+	flag.Int64Var(&opts.minFreeDisk, "min-free-disk", 0, "pause and then abort the run before an extraction when the output or temp directory has less than this many bytes free (0 disables the check)")
+	flag.BoolVar(&opts.verifyCRC, "verify-crc", false, "read every extracted file back and compare it with the CRC32 of the zip entry, a mismatch fails the program")
+	flag.BoolVar(&opts.listNew, "list-new", false, "print the programs the index marks as new and exit without downloading")
+	flag.BoolVar(&opts.appendUpdates, "append-updates", false, "append new FQDNs below a date marker to <platform>/Updates/<program>/new_fqdns.txt instead of writing Updates_<date> directories")
+	flag.IntVar(&opts.countConcurrency, "count-concurrency", 4, "maximum number of files whose lines are counted at the same time")
+	flag.StringVar(&opts.publish, "publish", "", "push every new FQDN with its program and platform to a message queue, e.g. redis://:password@localhost:6379/0?key=chaos:new_fqdns")
+	flag.BoolVar(&opts.globalNewOnly, "global-new-only", false, "report a FQDN as new only once across all programs and runs, the FQDNs reported so far are kept in "+globalSeenFile)
+	flag.StringVar(&opts.postProgramCmd, "post-program-cmd", "", "shell command run in the background after each program, it gets CHAOS_PROGRAM, CHAOS_PLATFORM, CHAOS_DOMAIN_DIR, CHAOS_UPDATE_DIR and CHAOS_NEW_FQDNS in its environment")
+	flag.IntVar(&opts.postProgramConcurrency, "post-program-concurrency", 2, "maximum number of -post-program-cmd commands running at the same time")
+	flag.BoolVar(&opts.indexSchemaGuard, "fail-fast-on-index-schema-change", true, "abort before touching the history if the index has no entries or none of them has a name, a URL or a count")
+	flag.Int64Var(&opts.mmapThreshold, "mmap-threshold", 0, "count the lines of uncompressed files at least this many bytes large through a memory mapping instead of reading them (0 never maps)")
+	flag.StringVar(&opts.reportFormat, "report-format", "text", "format of the final summary with the per-platform breakdown: text, json, csv or markdown")
+	flag.StringVar(&opts.reportFile, "report-file", "", "write the final summary in -report-format to this file instead of stdout")
+	fileMatch := flag.String("file-match", "", "only diff files whose path below the program matches this regular expression, e.g. '^example\\.com\\.txt$', the others only go to the history")
+	allowedHosts := flag.String("allowed-hosts", "", "comma separated hosts the download URLs of the index may point to (including subdomains), others are reported, e.g. chaos-data.projectdiscovery.io")
+	flag.BoolVar(&opts.strictHost, "strict-host", false, "skip programs whose download host is not on -allowed-hosts instead of only warning")
+	flag.BoolVar(&opts.additive, "additive", false, "merge each extraction into the history as the union of FQDNs per file instead of replacing it, nothing is ever removed from the history")
+	flag.BoolVar(&opts.progressJSON, "progress-json", false, "write one JSON status line per program and phase to stderr, independent of the log")
+	flag.BoolVar(&opts.retryOnZipError, "retry-on-zip-error", false, "treat a download that is not a readable zip as failed and download it again up to -retries times")
+	flag.BoolVar(&opts.patch, "patch", false, "write the added and removed FQDNs of every changed file as unified diff to changes_<date>.patch")
+	flag.IntVar(&opts.maxOpenFiles, "max-open-files", 0, "maximum number of domain files open at the same time across all programs (0 = half the open file limit of the process, -1 = no limit)")
+	flag.StringVar(&opts.tlsServerName, "tls-servername", "", "verify the TLS certificates against this name instead of the host connected to, e.g. for a mirror serving the certificate of the CDN")
+	flag.StringVar(&opts.emitIndex, "emit-index", "", "republish the processed programs as chaos index.json at this path, with the history of every program zipped next to it")
+	flag.StringVar(&opts.emitIndexURL, "emit-index-url", "", "prefix of the zip URLs in -emit-index, e.g. https://mirror.example.com/chaos/")
+	flag.Int64Var(&opts.maxMemory, "max-memory", 0, "soft limit of the memory of the process in bytes, above it fewer programs run at the same time until the usage drops again (0 disables the limit)")
+	flag.BoolVar(&opts.countOnly, "count-only", false, "only count the files and FQDNs of every archive in memory for the statistics and -count-change-report, nothing is extracted and the history is left untouched")
+	flag.BoolVar(&opts.metadataHeader, "metadata-header", false, "start every domain and update file with a '# program=... platform=... generated=...' comment line, comment lines are ignored by the diff")
+	flag.BoolVar(&opts.countHistory, "count-history", false, "append the file and FQDN counts of every program to <platform>/Counts/<program>/count_history.csv")
+	flag.StringVar(&opts.countTrend, "count-trend", "", "print the count history of this program written by -count-history and exit")
+	flag.IntVar(&opts.snapshots, "snapshots", 0, "copy the history into Snapshots/<timestamp> after every run and keep this many snapshots (0 takes none)")
+	flag.DurationVar(&opts.since, "since", 0, "diff against the newest snapshot taken at least this long ago, e.g. 168h for the changes of the last week")
+	flag.BoolVar(&opts.validateIndex, "validate-index", false, "check every entry of the index against the embedded JSON Schema and abort before touching the history if one violates it")
+	flag.StringVar(&opts.keepZips, "keep-zips", "", "save every downloaded archive as <platform>/<program>_<date>.zip in this directory unless it equals the last one saved, entries with file:// URLs reprocess them offline")
+	flag.BoolVar(&opts.reportNewPerApex, "report-new-per-apex", false, "add the number of distinct registered domains that gained new FQDNs across all programs to the statistics")
+	flag.StringVar(&opts.fromTemp, "from-temp", "", "diff the extractions saved in this directory (laid out as <platform>/<program> like with -keep-temp) against the history instead of downloading, add -keep-temp to leave the history untouched")
+	flag.Parse()
+
+	for _, prefix := range strings.Split(*fuzzyPrefixes, ",") {
+		if prefix = strings.ToLower(strings.TrimSpace(prefix)); prefix != "" {
+			opts.fuzzyPrefixes = append(opts.fuzzyPrefixes, prefix)
+		}
+	}
+	if *minChange != "" {
+		n, err := strconv.Atoi(*minChange)
+		if err != nil {
+			printError("Invalid -min-change value '%s', must be a number", *minChange)
+			os.Exit(1)
+		}
+		opts.minChange = &n
+	}
+	opts.nucleiScheme = strings.TrimSuffix(opts.nucleiScheme, "://")
+	opts.urlScheme = strings.TrimSuffix(opts.urlScheme, "://")
+	if opts.urlPath != "" && !strings.HasPrefix(opts.urlPath, "/") {
+		opts.urlPath = "/" + opts.urlPath
+	}
+	if len(opts.indexSources) == 0 {
+		opts.indexSources = stringList{indexURL}
+	}
+	for _, source := range opts.indexSources {
+		if err := validateIndexSource(source); err != nil {
+			printError("Invalid -index '%s': %v", source, err)
+			os.Exit(1)
+		}
+	}
+	if sanitizeName(opts.selfhostedName) == "" {
+		printError("-selfhosted-name must not be empty")
+		os.Exit(1)
+	}
+	if opts.singleFile != "" && opts.stream {
+		printError("-single-file and -stream can't be combined")
+		os.Exit(1)
+	}
+	if opts.fromTemp != "" {
+		if opts.stream || opts.countOnly {
+			printError("-from-temp can't be combined with -stream or -count-only")
+			os.Exit(1)
+		}
+		if err := checkFromTemp(opts.fromTemp); err != nil {
+			printError("Invalid -from-temp '%s': %v", opts.fromTemp, err)
+			os.Exit(1)
+		}
+	}
+	if opts.countOnly && (opts.stream || opts.singleFile != "") {
+		printError("-count-only can't be combined with -stream or -single-file")
+		os.Exit(1)
+	}
+	if opts.programsFile == "-" && opts.interactive {
+		printError("-programs-file - and -select both need stdin and can't be combined")
+		os.Exit(1)
+	}
+	if opts.keepWildcardHistory && !opts.ignoreWildcards {
+		printError("-keep-wildcard-history requires -ignore-wildcards")
+		os.Exit(1)
+	}
+	if opts.snapshots < 0 {
+		printError("-snapshots must not be negative")
+		os.Exit(1)
+	}
+	if opts.since > 0 {
+		if opts.diffAgainst != "" {
+			printError("-since and -diff-against can't be combined")
+			os.Exit(1)
+		}
+		baseline, err := findSnapshot(".", opts.since)
+		if err != nil {
+			printError("No baseline for -since %s: %v", opts.since, err)
+			os.Exit(1)
+		}
+		printInfo("Diffing against the snapshot of %s", baseline.taken.Format(time.DateTime))
+		opts.diffAgainst = baseline.path
+	}
+	if opts.diffAgainst != "" {
+		if info, err := os.Stat(opts.diffAgainst); err != nil || !info.IsDir() {
+			printError("-diff-against '%s' is not a directory", opts.diffAgainst)
+			os.Exit(1)
+		}
+	}
+	if hashAlgos[opts.hashAlgo] == nil {
+		printError("Invalid -hash-algo value '%s', must be sha256, blake3 or xxhash", opts.hashAlgo)
+		os.Exit(1)
+	}
+	if opts.minFreeDisk < 0 {
+		printError("-min-free-disk must not be negative")
+		os.Exit(1)
+	}
+	if opts.maxMemory < 0 {
+		printError("-max-memory must not be negative")
+		os.Exit(1)
+	}
+	if opts.countConcurrency <= 0 {
+		printError("Invalid -count-concurrency value %d, must be greater than 0", opts.countConcurrency)
+		os.Exit(1)
+	}
+	if opts.publish != "" {
+		if _, err := newPublisher(opts.publish); err != nil {
+			printError("Invalid -publish: %v", err)
+			os.Exit(1)
+		}
+	}
+	if opts.postProgramConcurrency <= 0 {
+		printError("Invalid -post-program-concurrency value %d, must be greater than 0", opts.postProgramConcurrency)
+		os.Exit(1)
+	}
+	if !reportFormats[opts.reportFormat] {
+		printError("Invalid -report-format '%s', must be text, json, csv or markdown", opts.reportFormat)
+		os.Exit(1)
+	}
+	if opts.reportFormat != "text" && opts.reportFile == "" && opts.stream {
+		printError("-stream writes the FQDNs to stdout, use -report-file for a -report-format other than text")
+		os.Exit(1)
+	}
+	if *fileMatch != "" {
+		re, err := regexp.Compile(*fileMatch)
+		if err != nil {
+			printError("Invalid -file-match: %v", err)
+			os.Exit(1)
+		}
+		opts.fileMatch = re
+	}
+	for _, host := range strings.Split(*allowedHosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			opts.allowedHosts = append(opts.allowedHosts, host)
+		}
+	}
+	if opts.strictHost && len(opts.allowedHosts) == 0 {
+		printError("-strict-host needs -allowed-hosts")
+		os.Exit(1)
+	}
+	if opts.additive && opts.incrementalHistory {
+		printError("-additive and -incremental-history can't be combined")
+		os.Exit(1)
+	}
+	if opts.maxOpenFiles < -1 {
+		printError("Invalid -max-open-files value %d, must be -1, 0 or greater", opts.maxOpenFiles)
+		os.Exit(1)
+	}
+	if opts.concurrency <= 0 {
+		printError("Invalid -concurrency value %d, must be greater than 0", opts.concurrency)
+		os.Exit(1)
+	}
+	limits, err := parsePlatformConcurrency(*platformConcurrency)
+	if err != nil {
+		printError("Invalid -platform-concurrency: %v", err)
+		os.Exit(1)
+	}
+	opts.platformConcurrency = limits
+	if compressExtensions[opts.compressAlgo] == "" {
+		printError("Invalid -compress-algo value '%s', must be gzip, zstd or brotli", opts.compressAlgo)
+		os.Exit(1)
+	}
+	switch opts.sortBy {
+	case "platform", "name", "count", "index":
+	default:
+		printError("Invalid -sort value '%s', must be platform, name, count or index", opts.sortBy)
+		os.Exit(1)
+	}
+	if opts.indexFieldMap, err = parseIndexFieldMap(*indexFieldMap); err != nil {
+		printError("Invalid -index-field-map: %v", err)
+		os.Exit(1)
+	}
+	if opts.filterConcurrency <= 0 {
+		printError("Invalid -filter-concurrency value %d, must be greater than 0", opts.filterConcurrency)
+		os.Exit(1)
+	}
+	if opts.filterTimeout < 0 {
+		printError("Invalid -filter-timeout value %s, must not be negative", opts.filterTimeout)
+		os.Exit(1)
+	}
+	if opts.resolverConcurrency <= 0 {
+		printError("Invalid -resolver-concurrency value %d, must be greater than 0", opts.resolverConcurrency)
+		os.Exit(1)
+	}
+	if opts.retries < 0 || opts.retryBudget < 0 || opts.breakerWindow < 0 {
+		printError("Invalid -retries, -retry-budget or -breaker-window value, must not be negative")
+		os.Exit(1)
+	}
+	switch opts.outputEncoding {
+	case "none", "punycode", "unicode":
+	default:
+		printError("Invalid -output-encoding value '%s', must be none, punycode or unicode", opts.outputEncoding)
+		os.Exit(1)
+	}
+	if opts.readBufferSize <= 0 {
+		printError("Invalid -read-buffer value %d, must be greater than 0", opts.readBufferSize)
+		os.Exit(1)
+	}
 }
 
 type Entry struct {
@@ -69,160 +608,753 @@ type Entry struct {
 }
 
 func main() {
+	start := time.Now()
+	parseFlags()
+	initLogging()
+	initOpenFiles(opts.maxOpenFiles)
 	printHeader("ChaosDomainDumper version %s", version)
+	if err := initHTTP(); err != nil {
+		printError("Error setting up HTTP: %v", err)
+		os.Exit(1)
+	}
 
-	resp, err := http.Get(indexURL)
-	if err != nil {
-		printError("Error fetching indexURL: %v", err)
-		panic(err)
+	if opts.healthcheck {
+		if !healthcheck(opts.indexSources, opts.healthcheckMin) {
+			os.Exit(1)
+		}
+		return
 	}
-	defer resp.Body.Close()
-	printSuccess("indexURL '%s' successfully fetched (Status: %d)", indexURL, resp.StatusCode)
 
-	var entries []Entry
-	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-		printError("Error decoding indexURL response: %v", err)
-		panic(err)
+	if opts.listUpdates {
+		if err := listUpdates("."); err != nil {
+			printError("Error listing updates: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.countTrend != "" {
+		if err := printCountTrend(".", opts.countTrend); err != nil {
+			printError("Error printing the count trend: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.verify {
+		if !verifyArchive(".") {
+			os.Exit(1)
+		}
+		return
 	}
-	printInfo("index.json contains %d entries", len(entries))
 
 	var (
-		totalPrograms   int
-		updatedPrograms int
-		totalFiles      int
-		totalFQDNs      int
-		totalNewFiles   int
-		totalNewFQDNs   int
+		sources    [][]Entry
+		indexMetas []IndexSource
 	)
-
-	for _, entry := range entries {
-		platform := sanitizeName(entry.Platform)
-		if platform == "" {
-			platform = "selfhosted"
+	for _, source := range opts.indexSources {
+		entries, meta, err := fetchIndex(source)
+		if err == nil && opts.indexSchemaGuard {
+			if err = checkIndexSchema(entries); err != nil {
+				err = fmt.Errorf("%w, the index format may have changed (disable the check with -fail-fast-on-index-schema-change=false)", err)
+			}
+		}
+		if err == nil && opts.validateIndex {
+			err = validateIndex(entries)
 		}
-		name := sanitizeName(entry.Name)
+		if err != nil {
+			printError("Error loading index '%s': %v", source, err)
+			notifyWebhook(&WebhookSummary{
+				Version:    version,
+				FinishedAt: time.Now(),
+				IndexError: fmt.Sprintf("loading index '%s': %v", source, err),
+			})
+			panic(err)
+		}
+		printSuccess("Index '%s' successfully loaded (%d entries)", source, len(entries))
+		sources = append(sources, entries)
+		indexMetas = append(indexMetas, meta)
+	}
 
-		domainDir := filepath.Join(platform, "Domains", name)
-		tempDir := filepath.Join(os.TempDir(), "chaos_temp", platform, name)
+	entries := mergeEntries(sources)
+	printInfo("Index contains %d entries", len(entries))
 
-		os.MkdirAll(filepath.Dir(domainDir), 0755)
-		os.MkdirAll(tempDir, 0755)
+	if opts.listNew {
+		listNewPrograms(entries)
+		return
+	}
 
-		printInfo("Checking for update for '%s' [%s]", entry.Name, entry.Platform)
+	// Read from the output root, which is the working directory
+	ignore, err := loadChaosIgnore(chaosIgnoreFile)
+	if err != nil {
+		printError("Error reading '%s': %v", chaosIgnoreFile, err)
+		os.Exit(1)
+	}
+	if ignore != nil {
+		kept := ignore.filterEntries(entries)
+		printInfo("Skipping %d programs listed in '%s'", len(entries)-len(kept), chaosIgnoreFile)
+		entries = kept
+	}
+
+	if len(opts.allowedHosts) > 0 {
+		entries = checkDownloadHosts(entries, opts.allowedHosts, opts.strictHost)
+	}
+
+	if opts.skipSelfhosted {
+		var platformEntries []Entry
+		for _, entry := range entries {
+			if sanitizeName(entry.Platform) != "" {
+				platformEntries = append(platformEntries, entry)
+			}
+		}
+		printInfo("Skipping %d self-hosted programs", len(entries)-len(platformEntries))
+		entries = platformEntries
+	}
 
-		zipData, err := downloadFile(entry.URL)
+	if opts.minChange != nil {
+		var changedEntries []Entry
+		for _, entry := range entries {
+			if entry.Change >= *opts.minChange {
+				changedEntries = append(changedEntries, entry)
+			}
+		}
+		printInfo("Skipping %d programs with a change below %d", len(entries)-len(changedEntries), *opts.minChange)
+		entries = changedEntries
+	}
+
+	if opts.programsFile != "" {
+		names, err := readProgramNames(opts.programsFile)
 		if err != nil {
-			printError("Download error: %v", err)
+			printError("Error reading programs from '%s': %v", opts.programsFile, err)
+			os.Exit(1)
+		}
+		entries = filterByProgramNames(entries, names)
+		printInfo("%d programs matched the %d names from '%s'", len(entries), len(names), opts.programsFile)
+	}
+
+	if opts.interactive {
+		entries = selectEntries(entries, os.Stdin)
+		if len(entries) == 0 {
+			printWarning("No programs selected, nothing to do")
+			return
+		}
+		printInfo("%d programs selected", len(entries))
+	}
+
+	var (
+		timings      []downloadTiming
+		phases       phaseTimings
+		entryResults []EntryResult
+		duplication  []duplicationStats
+		scope        []ScopeRow
+		targets      = make(map[string]bool)
+		deadFQDNs    = make(map[string][]string)
+		runFailures  []FailedProgram
+		countReport  []countMismatch
+		singleFile   = make(map[string]bool)
+		updateRoots  = make(map[string]int)
+		agg          = newAggregator()
+		patches      []string
+		emitted      []ProgramResult
+		stats        = &agg.stats
+		dnsResolver  *resolver
+	)
+	if opts.resolve {
+		dnsResolver = newResolver(opts.resolverConcurrency, opts.resolverTimeout)
+	}
+	manifest, err := loadManifest(manifestFile)
+	if err != nil {
+		printWarning("Error reading '%s', starting a new manifest: %v", manifestFile, err)
+		manifest = make(map[string]ManifestEntry)
+	}
+	failed, err := loadFailedPrograms(failedFile)
+	if err != nil {
+		printWarning("Error reading '%s': %v", failedFile, err)
+		failed = make(failedPrograms)
+	}
+	var seen lastSeen
+	if opts.pruneDeadAfter > 0 {
+		if seen, err = loadLastSeen(lastSeenFile); err != nil {
+			printWarning("Error reading '%s', starting over: %v", lastSeenFile, err)
+			seen = make(lastSeen)
+		}
+	}
+	if opts.globalNewOnly {
+		// Starting over would report every known FQDN again
+		if globalNew, err = loadGlobalSet(globalSeenFile); err != nil {
+			printError("Error reading '%s': %v", globalSeenFile, err)
+			os.Exit(1)
+		}
+	}
+	if opts.retryFailed {
+		var retry []Entry
+		for _, entry := range entries {
+			if failed.contains(entry) {
+				retry = append(retry, entry)
+			}
+		}
+		printInfo("Retrying %d of %d previously failed programs", len(retry), len(failed))
+		entries = retry
+	}
+	var publisher Publisher
+	if opts.publish != "" {
+		// Already validated by parseFlags
+		publisher, _ = newPublisher(opts.publish)
+		defer publisher.Close()
+	}
+	proc := &processor{
+		budget:    &retryBudget{remaining: opts.retryBudget},
+		breaker:   newCircuitBreaker(opts.breakerWindow, opts.breakerThreshold),
+		archives:  newArchiveCache(entries),
+		ignore:    ignore,
+		resolver:  dnsResolver,
+		publisher: publisher,
+		memory:    newMemoryGovernor(opts.maxMemory),
+		total:     len(entries),
+	}
+	if opts.postProgramCmd != "" {
+		proc.hooks = newHookRunner(opts.postProgramCmd, opts.postProgramConcurrency)
+	}
+	var deadline time.Time
+	if opts.maxRuntime > 0 {
+		deadline = start.Add(opts.maxRuntime)
+	}
+
+	sortEntries(entries, opts.sortBy)
+	results := proc.run(entries, deadline)
+	aborted := false
+	for result := range results {
+		if result.aborted {
+			aborted = true
 			continue
 		}
+		if !result.Success {
+			failed.record(result.Entry, result.Err)
+			runFailures = append(runFailures, failed[failedKey(result.Entry)])
+			entryResults = append(entryResults, EntryResult{Entry: result.Entry, Error: result.Err.Error()})
+			continue
+		}
+
+		if result.downloadDuration > 0 {
+			phases.Download += result.downloadDuration
+			timings = append(timings, downloadTiming{
+				Program:  result.Program,
+				Platform: result.Platform,
+				Bytes:    result.BytesDownloaded,
+				Duration: result.downloadDuration,
+			})
+		}
+		phases.Extract += result.extractDuration
+		phases.Diff += result.diffDuration
 
-		extractZip(zipData, tempDir)
+		agg.add(result)
+		if opts.emitIndex != "" {
+			emitted = append(emitted, result)
+		}
+		if result.patch != "" {
+			patches = append(patches, result.patch)
+		}
+		if result.NewFQDNs > 0 && result.updateRoot != "" {
+			updateRoots[result.updateRoot] += result.NewFQDNs
+		}
 
-		date := time.Now().Format("2006-01-02")
-		updateDir := filepath.Join(platform, "Updates"+"_"+date, name)
+		for _, fqdn := range result.fqdns {
+			singleFile[fqdn] = true
+		}
+		for _, target := range result.targets {
+			targets[strings.ToLower(target)] = true
+		}
+		countReport = append(countReport, countMismatch{Program: result.Program, Platform: result.Platform, Feed: result.Entry.Count, Actual: result.FQDNCount})
+		if result.duplication != nil {
+			duplication = append(duplication, *result.duplication)
+		}
+		if result.manifestKey != "" {
+			manifest[result.manifestKey] = result.manifest
+			if seen != nil {
+				seen.update(result.manifestKey, result.seen, start)
+				if dead := seen.stale(result.manifestKey, start.Add(-opts.pruneDeadAfter)); len(dead) > 0 {
+					deadFQDNs[result.manifestKey] = dead
+				}
+			}
+			scope = append(scope, ScopeRow{Name: result.Program, Platform: result.Platform, ProgramURL: result.Entry.ProgramURL, Bounty: result.Entry.Bounty, DomainDir: result.domainDir})
+		}
+		failed.clear(result.Entry)
+		entryResults = append(entryResults, EntryResult{Entry: result.Entry, FileCount: result.FileCount, FQDNCount: result.FQDNCount, NewFQDNCount: result.NewFQDNs})
+	}
+	// Programs skipped after an abort don't count as time-limited
+	if skipped := int(proc.skipped.Load()); skipped > 0 && !aborted {
+		stats.TimeLimited = true
+		stats.SkippedPrograms = skipped
+	}
 
-		newFiles, newFQDNs := copyNewDomains(tempDir, domainDir, updateDir)
-		if newFiles > 0 || newFQDNs > 0 {
-			printSuccess("Found updates: %d new files, %d new FQDNs", newFiles, newFQDNs)
+	proc.archives.closeAll()
+	setLogProgram("", "")
+	if proc.hooks != nil {
+		proc.hooks.wait()
+	}
 
-			totalNewFiles += newFiles
-			totalNewFQDNs += newFQDNs
+	if !opts.stream && opts.singleFile == "" && !opts.countOnly {
+		if err := writeManifest(manifestFile, manifest); err != nil {
+			printError("Error writing '%s': %v", manifestFile, err)
+		}
+	}
+	// A snapshot of a partial run would be a misleading baseline for -since
+	if opts.snapshots > 0 && !aborted && !opts.stream && opts.singleFile == "" && !opts.countOnly {
+		if path, err := takeSnapshot(".", opts.snapshots); err != nil {
+			printError("Error taking a snapshot of the history: %v", err)
 		} else {
-			os.RemoveAll(updateDir)
+			printSuccess("Snapshot of the history written to '%s'", path)
 		}
+	}
+	if seen != nil {
+		if err := seen.save(lastSeenFile); err != nil {
+			printError("Error writing '%s': %v", lastSeenFile, err)
+		}
+		printDeadFQDNs(deadFQDNs, opts.pruneDeadAfter)
+	}
+	if globalNew != nil {
+		if err := globalNew.save(globalSeenFile); err != nil {
+			printError("Error writing '%s': %v", globalSeenFile, err)
+		}
+	}
+	if opts.dedupeReport != "" {
+		sortByDuplication(duplication)
+		if err := writeDedupeReport(opts.dedupeReport, duplication); err != nil {
+			printError("Error writing '%s': %v", opts.dedupeReport, err)
+		} else {
+			printSuccess("Duplication report written to '%s'", opts.dedupeReport)
+		}
+		printDedupeReport(duplication, 10)
+	}
+	if opts.singleFile != "" {
+		if err := writeSingleFile(opts.singleFile, singleFile); err != nil {
+			printError("Error writing '%s': %v", opts.singleFile, err)
+		} else {
+			printSuccess("%d unique FQDNs written to '%s'", len(singleFile), opts.singleFile)
+		}
+	}
+	if opts.countReport != "" {
+		if err := writeCountReport(opts.countReport, countReport, opts.countTolerance); err != nil {
+			printError("Error writing '%s': %v", opts.countReport, err)
+		} else {
+			printSuccess("Count comparison written to '%s'", opts.countReport)
+		}
+		printCountMismatches(countReport, opts.countTolerance)
+	}
+	if opts.exportScope != "" {
+		if err := writeScope(opts.exportScope, scope); err != nil {
+			printError("Error writing '%s': %v", opts.exportScope, err)
+		} else {
+			printSuccess("Scope of %d programs written to '%s'", len(scope), opts.exportScope)
+		}
+	}
+	if opts.sizeReport > 0 && !opts.stream && !opts.countOnly {
+		printSizeReport(programSizes("."), opts.sizeReport)
+	}
+	if opts.nucleiTargets != "" {
+		if n, err := writeNucleiTargets(opts.nucleiTargets, targets, opts.nucleiScheme); err != nil {
+			printError("Error writing '%s': %v", opts.nucleiTargets, err)
+		} else {
+			printSuccess("%d nuclei targets written to '%s'", n, opts.nucleiTargets)
+		}
+	}
+	if opts.emitIndex != "" {
+		if n, err := writeEmitIndex(opts.emitIndex, opts.emitIndexURL, emitted); err != nil {
+			printError("Error writing '%s': %v", opts.emitIndex, err)
+		} else {
+			printSuccess("Index of %d programs written to '%s'", n, opts.emitIndex)
+		}
+	}
+	if len(patches) > 0 {
+		// Programs finish in any order with -concurrency
+		sort.Strings(patches)
+		path := patchFile()
+		if err := os.WriteFile(path, []byte(strings.Join(patches, "")), 0644); err != nil {
+			printError("Error writing '%s': %v", path, err)
+		} else {
+			printSuccess("Changes of %d programs written to '%s'", len(patches), path)
+		}
+	}
+	if opts.entriesJSON != "" {
+		if err := writeEntriesJSON(opts.entriesJSON, entryResults); err != nil {
+			printError("Error writing '%s': %v", opts.entriesJSON, err)
+		} else {
+			printSuccess("Processed entries written to '%s'", opts.entriesJSON)
+		}
+	}
+	if err := failed.save(failedFile); err != nil {
+		printError("Error writing '%s': %v", failedFile, err)
+	} else if len(failed) > 0 {
+		printWarning("%d programs failed, rerun with -retry-failed to process only them", len(failed))
+	}
 
-		fileCount, fqdnCount := countDomainsAndFQDNs(tempDir)
-		totalFiles += fileCount
-		totalFQDNs += fqdnCount
-
-		updatedPrograms++
-		totalPrograms++
+	for updateRoot, newFQDNs := range updateRoots {
+		if err := writeRunInfo(updateRoot, newFQDNs, stats.NewFQDNs, indexMetas); err != nil {
+			printWarning("Error writing '%s': %v", filepath.Join(updateRoot, runInfoFile), err)
+		}
+	}
 
-		os.RemoveAll(domainDir)
-		os.Rename(tempDir, domainDir)
+	if opts.zipUpdates {
+		for updateRoot := range updateRoots {
+			if err := zipUpdateDir(updateRoot); err != nil {
+				printError("Error zipping '%s': %v", updateRoot, err)
+				continue
+			}
+			printSuccess("Updates packed into '%s.zip'", updateRoot)
+		}
 	}
 
 	// Statistics
-	printHeader("──────────────────────────────")
-	printHeader("FINAL STATISTICS")
-	printHeader("──────────────────────────────")
-	printStats("Processed programs:             %d", totalPrograms)
-	printStats("Programs with updates:          %d", updatedPrograms)
-	printStats("Second-level domains (files):   %d", totalFiles)
-	printStats("Total FQDNs (lines):            %d", totalFQDNs)
-	printStats("New files (updates):            %d", totalNewFiles)
-	printStats("New FQDNs (updates):            %d", totalNewFQDNs)
+	stats.FinishedAt = time.Now()
+	stats.Elapsed = time.Since(start)
+	var previousStats *Statistics
+	if opts.statsJSON != "" {
+		if previousStats, err = loadStatistics(opts.statsJSON); err != nil {
+			printWarning("Error reading previous statistics from '%s': %v", opts.statsJSON, err)
+		}
+	}
+	platformStats := agg.platformStatistics()
+	if opts.reportFormat != "text" && opts.reportFile == "" {
+		if err := writeReport(os.Stdout, opts.reportFormat, stats, platformStats); err != nil {
+			printError("Error writing the report: %v", err)
+		}
+	} else {
+		printStatistics(stats, previousStats)
+		printPlatformStatistics(platformStats)
+	}
+	if opts.reportFile != "" {
+		if err := writeReportFile(opts.reportFile, opts.reportFormat, stats, platformStats); err != nil {
+			printError("Error writing the report to '%s': %v", opts.reportFile, err)
+		} else {
+			printSuccess("Report written to '%s'", opts.reportFile)
+		}
+	}
+	// Incomplete totals would distort the comparison of the next run
+	if opts.statsJSON != "" && !aborted && !opts.stream {
+		if err := writeStatistics(opts.statsJSON, stats); err != nil {
+			printError("Error writing statistics to '%s': %v", opts.statsJSON, err)
+		}
+	}
+	if err := output.Finish(stats); err != nil {
+		printError("Error finishing the output: %v", err)
+	}
+	notifyWebhook(&WebhookSummary{
+		Version:    version,
+		FinishedAt: stats.FinishedAt,
+		Failed:     runFailures,
+		Statistics: stats,
+	})
+	if stats.TimeLimited {
+		printWarning("The run was time-limited by -max-runtime, %d programs were not processed", stats.SkippedPrograms)
+	}
+	if aborted {
+		printError("The run was aborted, statistics are incomplete")
+		defer os.Exit(1)
+	}
+
+	if opts.timingsFile != "" {
+		if err := writeTimingsCSV(opts.timingsFile, timings); err != nil {
+			printError("Error writing timings to '%s': %v", opts.timingsFile, err)
+		} else {
+			printSuccess("Download timings written to '%s'", opts.timingsFile)
+		}
+		printSlowestDownloads(timings, 10)
+		printPhaseTimings(phases)
+	}
 }
 
-func countDomainsAndFQDNs(root string) (int, int) {
-	fileCount := 0
-	fqdnCount := 0
+// IndexSource describes a loaded index for run.json
+type IndexSource struct {
+	Source       string `json:"source"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Entries      int    `json:"entries"`
+}
+
+// validateIndexSource checks that source is an http(s) URL or a readable
+// file, so a typo fails before any work instead of deep in the HTTP client
+func validateIndexSource(source string) error {
+	if strings.Contains(source, "://") {
+		u, err := url.Parse(source)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("unsupported scheme '%s', only http and https are allowed", u.Scheme)
+		}
+		if u.Host == "" {
+			return errors.New("missing host")
+		}
+		return nil
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("neither an http(s) URL nor a readable file: %w", err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return errors.New("is a directory")
+	}
+	return nil
+}
 
+// fetchIndex loads an index.json array from an http(s) URL or a local file
+func fetchIndex(source string) ([]Entry, IndexSource, error) {
+	meta := IndexSource{Source: source}
+	var r io.Reader
+	// validateIndexSource only lets http(s) URLs through
+	if strings.Contains(source, "://") {
+		resp, err := httpGet(httpClient, source)
+		if err != nil {
+			return nil, meta, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, meta, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		meta.ETag = resp.Header.Get("ETag")
+		meta.LastModified = resp.Header.Get("Last-Modified")
+		body, err := responseBody(resp)
+		if err != nil {
+			return nil, meta, err
+		}
+		r = body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, meta, err
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil {
+			meta.LastModified = info.ModTime().UTC().Format(http.TimeFormat)
+		}
+		r = f
+	}
+
+	var entries []Entry
+	if len(opts.indexFieldMap) > 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, meta, err
+		}
+		if entries, err = remapEntries(data, opts.indexFieldMap); err != nil {
+			return nil, meta, fmt.Errorf("decoding index: %w", err)
+		}
+	} else if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, meta, fmt.Errorf("decoding index: %w", err)
+	}
+	meta.Entries = len(entries)
+	return entries, meta, nil
+}
+
+// readProgramNames reads one program name per line from path or stdin for "-".
+// Empty lines and lines starting with # are ignored.
+func readProgramNames(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" && !strings.HasPrefix(name, "#") {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// filterByProgramNames keeps the entries whose name is in names, compared
+// case-insensitively, and warns about names missing from the index
+func filterByProgramNames(entries []Entry, names []string) []Entry {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[strings.ToLower(name)] = true
+	}
+
+	var filtered []Entry
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		key := strings.ToLower(entry.Name)
+		if wanted[key] {
+			filtered = append(filtered, entry)
+			found[key] = true
+		}
+	}
+	for _, name := range names {
+		if !found[strings.ToLower(name)] {
+			printWarning("Program '%s' not found in the index", name)
+		}
+	}
+	return filtered
+}
+
+// mergeEntries combines several index arrays into one, deduplicated by
+// name+platform. A later source wins but keeps the position of the first occurrence.
+func mergeEntries(sources [][]Entry) []Entry {
+	var merged []Entry
+	seen := make(map[string]int)
+	for _, entries := range sources {
+		for _, entry := range entries {
+			key := entry.Platform + "\x00" + entry.Name
+			if i, ok := seen[key]; ok {
+				merged[i] = entry
+				continue
+			}
+			seen[key] = len(merged)
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// countDomainsAndFQDNs returns the number of files below root and their
+// total number of lines. Up to -count-concurrency files are counted at the
+// same time.
+func countDomainsAndFQDNs(root string) (int, int) {
+	var paths []string
 	filepath.WalkDir(root, func(path string, d os.DirEntry, _ error) error {
 		if d != nil && !d.IsDir() {
-			fileCount++
-			lines, err := countLines(path)
-			if err == nil {
-				fqdnCount += lines
-			}
+			paths = append(paths, path)
 		}
 		return nil
 	})
-	return fileCount, fqdnCount
+
+	var fqdnCount atomic.Int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.countConcurrency)
+	for _, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if lines, err := countLines(path); err == nil {
+				fqdnCount.Add(int64(lines))
+			}
+		}(path)
+	}
+	wg.Wait()
+	return len(paths), int(fqdnCount.Load())
 }
 
+// countLines returns the number of lines in filePath. A final line without a
+// trailing newline is counted as well, so the result always matches
+// len(readLines(filePath)).
 func countLines(filePath string) (int, error) {
-	f, err := os.Open(filePath)
+	if opts.mmapThreshold > 0 && !isCompressed(filePath) {
+		if info, err := os.Stat(filePath); err == nil && info.Size() >= opts.mmapThreshold {
+			if count, err := countMappedLines(filePath); err == nil {
+				return count, nil
+			}
+			// Fall back to reading the file
+		}
+	}
+	f, err := openHistoryFile(filePath)
 	if err != nil {
 		return 0, err
 	}
 	defer f.Close()
+	return countReaderLines(f)
+}
 
-	buf := make([]byte, 32*1024)
-	count := 0
-	lineSep := []byte{'\n'}
+// countMappedLines counts the lines of a memory-mapped file, which saves the
+// copying into a buffer for very large files
+func countMappedLines(filePath string) (int, error) {
+	data, unmap, err := mapFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer unmap()
+	var lines lineCounter
+	lines.Write(data)
+	return lines.count(), nil
+}
 
-	for {
-		c, err := f.Read(buf)
-		count += bytes.Count(buf[:c], lineSep)
+// countReaderLines counts the lines of r the same way as countLines
+func countReaderLines(r io.Reader) (int, error) {
+	var lines lineCounter
+	_, err := io.CopyBuffer(&lines, r, make([]byte, max(opts.readBufferSize, 512)))
+	return lines.count(), err
+}
 
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return count, err
-		}
+// bountyDir is the top-level directory of an entry for -split-bounty
+func bountyDir(entry Entry) string {
+	if entry.Bounty {
+		return "bounty"
 	}
-	return count, nil
+	return "vdp"
 }
 
 func sanitizeName(name string) string {
 	name = strings.ReplaceAll(name, " ", "_")
 	name = strings.ReplaceAll(name, "/", "_")
 	name = strings.ReplaceAll(name, "\\", "_")
-	return name
+	return sanitizePlatformName(name)
 }
 
-func downloadFile(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// sanitizeZipPath makes every element of a slash separated zip entry name
+// safe to create on the current platform
+func sanitizeZipPath(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = sanitizePlatformName(part)
+	}
+	return filepath.Join(parts...)
+}
+
+func downloadFile(url string) (*zipArchive, error) {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		return openLocalArchive(path)
+	}
+	if downloadProxies != nil {
+		return downloadProxies.download(url)
+	}
+	return downloadWithClient(httpClient, url)
+}
+
+func downloadWithClient(client *http.Client, url string) (*zipArchive, error) {
+	resp, err := httpGet(client, url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return nil, errProxyAuth
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d for '%s'", resp.StatusCode, url)
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return readArchive(body, opts.spoolThreshold)
 }
 
-func extractZip(zipData []byte, outDir string) {
-	r, err := zip.NewReader(bytes.NewReader(zipData), int64(len(zipData)))
+// extractZip writes all files of the archive to outDir. Entries that cannot be
+// opened are skipped, but an unreadable archive or a failed write (e.g. a full
+// disk) aborts the extraction since a truncated tree would corrupt the diff. The lines are
+// counted while writing, it returns the number of files and FQDNs extracted.
+func extractZip(archive *zipArchive, outDir string) (int, int, error) {
+	r, err := archive.open()
 	if err != nil {
-		printError("Error extracting zip: %v", err)
-		return
+		// An empty extraction would wipe the history in the swap
+		return 0, 0, fmt.Errorf("opening zip: %w", err)
 	}
 
 	os.MkdirAll(outDir, 0755)
 
+	var counts extractCounts
 	for _, f := range r.File {
-		path := filepath.Join(outDir, f.Name)
+		path := filepath.Join(outDir, sanitizeZipPath(f.Name))
 		if f.FileInfo().IsDir() {
 			os.MkdirAll(path, f.Mode())
 			continue
@@ -230,27 +1362,156 @@ func extractZip(zipData []byte, outDir string) {
 
 		rc, err := f.Open()
 		if err != nil {
-			continue
+			return counts.files, counts.lines, fmt.Errorf("opening '%s': %w", f.Name, err)
 		}
 
 		os.MkdirAll(filepath.Dir(path), 0755)
-		outFile, err := os.Create(path)
+		err = writeExtractedFile(path, rc, &counts)
+		rc.Close()
 		if err != nil {
-			rc.Close()
-			continue
+			return counts.files, counts.lines, fmt.Errorf("writing '%s': %w", f.Name, err)
+		}
+		if opts.verifyCRC {
+			if err := verifyCRC(path, f.CRC32); err != nil {
+				os.Remove(path)
+				return counts.files, counts.lines, fmt.Errorf("verifying '%s': %w", f.Name, err)
+			}
 		}
+	}
+	return counts.files, counts.lines, nil
+}
 
-		io.Copy(outFile, rc)
-		rc.Close()
-		outFile.Close()
+// extractCounts sums up the files written by extractZip and their lines
+type extractCounts struct {
+	files int
+	lines int
+}
+
+// commentSpace are the bytes allowed in front of the '#' of a comment line
+const commentSpace = " \t\r\v\f"
+
+// isComment reports whether line is a comment like the -metadata-header: its
+// first byte other than commentSpace is '#'. readLines, lineCounter and with
+// it all line counts apply this one rule.
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, commentSpace), "#")
+}
+
+// lineCounter is an io.Writer counting the lines that aren't comments. It
+// is the line count of countLines, countReaderLines and countMappedLines, a
+// final line without a trailing newline is counted as well.
+type lineCounter struct {
+	lines int
+	// inLine is set while the current line has no newline yet, decided once
+	// its first byte other than commentSpace was seen
+	inLine, decided, comment bool
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if !c.decided {
+			i := 0
+			for i < len(p) && p[i] != '\n' && strings.IndexByte(commentSpace, p[i]) >= 0 {
+				i++
+			}
+			if i < len(p) && p[i] != '\n' {
+				c.decided, c.comment = true, p[i] == '#'
+			}
+		}
+		end := bytes.IndexByte(p, '\n')
+		if end < 0 {
+			// The line continues in the next write
+			c.inLine = true
+			break
+		}
+		if !c.comment {
+			c.lines++
+		}
+		c.inLine, c.decided, c.comment = false, false, false
+		p = p[end+1:]
+	}
+	return n, nil
+}
+
+func (c *lineCounter) count() int {
+	if c.inLine && !c.comment {
+		return c.lines + 1
+	}
+	return c.lines
+}
+
+// errCRCMismatch marks an extracted file that differs from its zip entry
+var errCRCMismatch = errors.New("CRC32 mismatch")
+
+// verifyCRC reads the extracted file at path back and compares it with the
+// CRC32 recorded in the zip entry
+func verifyCRC(path string, want uint32) error {
+	acquireFile()
+	defer releaseFile()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := h.Sum32(); got != want {
+		return fmt.Errorf("%w: got %08x, want %08x", errCRCMismatch, got, want)
+	}
+	return nil
+}
+
+// createExtracted creates the destination of an extracted file. Tests swap it
+// for a writer that fails like a full or broken disk.
+var createExtracted = func(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+// writeExtractedFile copies r into a new file at path and adds it to counts.
+// Any error fails the extraction, a file missing from it would be deleted from
+// the history by the swap. On a write error the partial file is removed.
+func writeExtractedFile(path string, r io.Reader, counts *extractCounts) error {
+	acquireFile()
+	defer releaseFile()
+	outFile, err := createExtracted(path)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("disk full: %w", err)
+		}
+		return err
+	}
+
+	var lines lineCounter
+	_, err = io.Copy(io.MultiWriter(outFile, &lines), r)
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
 	}
+	counts.files++
+	counts.lines += lines.count()
+	return nil
 }
 
-func copyNewDomains(newDir, oldDir, updateDir string) (int, int) {
+// copyNewDomains writes every line of newDir missing in oldDir through the
+// output to updateDir and returns the number of new or updated files together
+// with the new FQDNs. With an empty updateDir nothing is written, only the
+// diff is computed.
+func copyNewDomains(newDir, oldDir, updateDir, program, platform string) (int, []string) {
 	newFileCount := 0
-	newFQDNCount := 0
+	var newFQDNs []string
 
-	printInfo("Processing: %s -> %s -> %s", newDir, oldDir, updateDir)
+	if updateDir != "" {
+		printInfo("Processing: %s -> %s -> %s", newDir, oldDir, updateDir)
+	} else {
+		printInfo("Processing: %s -> %s", newDir, oldDir)
+	}
 	filepath.WalkDir(newDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			printWarning("Error processing path: %v", err)
@@ -260,38 +1521,111 @@ func copyNewDomains(newDir, oldDir, updateDir string) (int, int) {
 		}
 
 		relPath, _ := filepath.Rel(newDir, path)
-		oldPath := filepath.Join(oldDir, relPath)
-		destPath := filepath.Join(updateDir, relPath)
+		if !fileMatches(relPath) {
+			return nil
+		}
+		oldPath, exists := findHistoryFile(filepath.Join(oldDir, relPath))
 
-		if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		if !exists {
 			// Datei existiert nicht im oldDir, komplett kopieren
-			os.MkdirAll(filepath.Dir(destPath), 0755)
-			copyFile(path, destPath)
+			lines, _ := readLines(path)
+			if opts.ignoreWildcards {
+				lines, _ = dropWildcards(lines)
+			}
+			// Written from the trimmed lines so updates always use LF
+			lines = reportNewFQDNs(program, platform, updateDir, relPath, lines)
+			if len(lines) == 0 {
+				// Nothing new to report, don't create the update tree for it
+				return nil
+			}
 			newFileCount++
-			fqdnLines, _ := countLines(path)
-			newFQDNCount += fqdnLines
-			printSuccess("New file: %s (%d FQDNs)", relPath, fqdnLines)
+			newFQDNs = append(newFQDNs, lines...)
+			if opts.sampleNew < 0 {
+				printEvent([]any{"file", relPath, "new_fqdns", len(lines)}, "New file: %s (%d FQDNs)", relPath, len(lines))
+			}
 		} else {
 			// Datei existiert in beiden Verzeichnissen, Zeilen vergleichen
 			newLines, err := getNewLines(path, oldPath)
+			if opts.ignoreWildcards {
+				newLines, _ = dropWildcards(newLines)
+			}
+			if err == nil {
+				newLines = reportNewFQDNs(program, platform, updateDir, relPath, newLines)
+			}
 			if err == nil && len(newLines) > 0 {
-				os.MkdirAll(filepath.Dir(destPath), 0755)
-				f, err := os.Create(destPath)
-				if err == nil {
-					for _, line := range newLines {
-						f.WriteString(line + "\n")
-					}
-					f.Close()
-					newFileCount++
-					newFQDNCount += len(newLines)
-					printSuccess("Updated file: %s (%d new FQDNs)", relPath, len(newLines))
+				newFileCount++
+				newFQDNs = append(newFQDNs, newLines...)
+				if opts.sampleNew < 0 {
+					printEvent([]any{"file", relPath, "new_fqdns", len(newLines)}, "Updated file: %s (%d new FQDNs)", relPath, len(newLines))
 				}
 			}
 		}
 		return nil
 	})
 
-	return newFileCount, newFQDNCount
+	return newFileCount, newFQDNs
+}
+
+// copyAllDomains copies every non-empty file of newDir through the output to
+// updateDir without looking at the history and returns the number of files
+// and their FQDNs. With an empty updateDir nothing is written.
+func copyAllDomains(newDir, updateDir, program, platform string) (int, []string) {
+	fileCount := 0
+	var fqdns []string
+
+	filepath.WalkDir(newDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			printWarning("Error processing path: %v", err)
+			return nil
+		} else if d.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(newDir, path)
+		if !fileMatches(relPath) {
+			return nil
+		}
+		lines, _ := readLines(path)
+		if opts.ignoreWildcards {
+			lines, _ = dropWildcards(lines)
+		}
+		lines = reportNewFQDNs(program, platform, updateDir, relPath, lines)
+		if len(lines) == 0 {
+			return nil
+		}
+		fileCount++
+		fqdns = append(fqdns, lines...)
+		return nil
+	})
+
+	return fileCount, fqdns
+}
+
+// reportNewFQDNs writes the new FQDNs of the domain file relPath through the
+// output to updateDir and returns those reported. -global-new-only leaves out
+// FQDNs reported before and only keeps the rest claimed if the write succeeds,
+// a failed write reports nothing. With an empty updateDir nothing is written.
+func reportNewFQDNs(program, platform, updateDir, relPath string, fqdns []string) []string {
+	if globalNew != nil {
+		fqdns, _ = globalNew.claim(fqdns)
+	}
+	if len(fqdns) == 0 || updateDir == "" {
+		return fqdns
+	}
+	if err := output.WriteNewFQDNs(program, platform, updateDir, relPath, fqdns); err != nil {
+		printWarning("Error writing '%s': %v", filepath.Join(updateDir, relPath), err)
+		if globalNew != nil {
+			globalNew.release(fqdns)
+		}
+		return nil
+	}
+	return fqdns
+}
+
+// fileMatches reports whether the file at relPath below a program is diffed
+// under -file-match
+func fileMatches(relPath string) bool {
+	return opts.fileMatch == nil || opts.fileMatch.MatchString(filepath.ToSlash(relPath))
 }
 
 // Hilfsfunktion: Gibt alle Zeilen zurück, die in fileA, aber nicht in fileB sind
@@ -304,6 +1638,8 @@ func getNewLines(fileA, fileB string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	// History written before -output-encoding was enabled may still use the other form
+	bLines = normalizeFQDNs(bLines)
 	bSet := make(map[string]struct{}, len(bLines))
 	for _, line := range bLines {
 		bSet[line] = struct{}{}
@@ -319,17 +1655,21 @@ func getNewLines(fileA, fileB string) ([]string, error) {
 
 // Hilfsfunktion: Liest alle Zeilen einer Datei als Slice
 func readLines(filePath string) ([]string, error) {
-	f, err := os.Open(filePath)
+	f, err := openHistoryFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	return splitLines(f)
+}
 
+// splitLines reads the lines of r with the rules of readLines
+func splitLines(r io.Reader) ([]string, error) {
 	var lines []string
 	buf := make([]byte, 4096)
 	var partial string
 	for {
-		n, err := f.Read(buf)
+		n, err := r.Read(buf)
 		if n > 0 {
 			chunk := partial + string(buf[:n])
 			parts := strings.Split(chunk, "\n")
@@ -346,24 +1686,36 @@ func readLines(filePath string) ([]string, error) {
 	if partial != "" {
 		lines = append(lines, partial)
 	}
-	return lines, nil
+	// CRLF files would otherwise differ from the same FQDNs written with LF,
+	// comment lines like the -metadata-header are no FQDNs
+	kept := lines[:0]
+	for _, line := range lines {
+		if !isComment(line) {
+			kept = append(kept, strings.TrimSpace(line))
+		}
+	}
+	return kept, nil
 }
 
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
+// writeLines writes every line terminated by a newline to filePath
+func writeLines(filePath string, lines []string) error {
+	acquireFile()
+	defer releaseFile()
+	f, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
-	defer in.Close()
 
-	out, err := os.Create(dst)
-	if err != nil {
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		w.WriteString(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
 		return err
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
-	return err
+	return f.Close()
 }
 
 func countFilesInDir(root string) int {
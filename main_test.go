@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// defaultOpts are the options of a run without any flags
+var defaultOpts options
+
+func TestMain(m *testing.M) {
+	// The test flags are registered on the same flag set, parseFlags accepts them
+	parseFlags()
+	defaultOpts = opts
+	logOutput = io.Discard
+	os.Exit(m.Run())
+}
+
+// setOpts resets the options to their defaults, applies change and restores
+// the defaults after the test
+func setOpts(t testing.TB, change func(o *options)) {
+	t.Helper()
+	opts = defaultOpts
+	if change != nil {
+		change(&opts)
+	}
+	t.Cleanup(func() { opts = defaultOpts })
+}
+
+// makeZip returns an archive with the given files and contents
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// inTempDir runs the test in a fresh output directory with its own TMPDIR, as
+// the archive layout is relative to the working directory
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("TMPDIR", t.TempDir())
+	return dir
+}
+
+// newTestProcessor is the processor main sets up for entries
+func newTestProcessor(entries []Entry) *processor {
+	return &processor{
+		budget:   &retryBudget{remaining: opts.retryBudget},
+		breaker:  newCircuitBreaker(opts.breakerWindow, opts.breakerThreshold),
+		archives: newArchiveCache(entries),
+		total:    len(entries),
+	}
+}
+
+// zipServer serves the archive for every request
+func zipServer(t *testing.T, archive []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeFile creates path with its parent directories
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const manifestFile = "manifest.json"
+
+// ManifestEntry describes the domain set of one program so consumers can
+// detect changes without walking the files
+type ManifestEntry struct {
+	FileCount   int    `json:"file_count"`
+	FQDNCount   int    `json:"fqdn_count"`
+	ContentHash string `json:"content_hash"`
+}
+
+// loadManifest reads the manifest of the previous run, a missing file yields an empty manifest
+func loadManifest(path string) (map[string]ManifestEntry, error) {
+	manifest := make(map[string]ManifestEntry)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeManifest replaces the manifest atomically so readers never see a partial file
+func writeManifest(path string, manifest map[string]ManifestEntry) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// buildManifestEntry counts the files and FQDNs below dir and hashes the
+// sorted, deduplicated FQDN set, which is independent of file layout and order
+func buildManifestEntry(dir string) ManifestEntry {
+	var entry ManifestEntry
+	fqdns := make(map[string]struct{})
+
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		entry.FileCount++
+		entry.FQDNCount += len(lines)
+		for _, line := range lines {
+			fqdns[line] = struct{}{}
+		}
+		return nil
+	})
+
+	sorted := make([]string, 0, len(fqdns))
+	for fqdn := range fqdns {
+		sorted = append(sorted, fqdn)
+	}
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, fqdn := range sorted {
+		h.Write([]byte(fqdn))
+		h.Write([]byte{'\n'})
+	}
+	entry.ContentHash = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	return entry
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryPoll is how often a throttled dispatch checks the memory usage again
+const memoryPoll = 250 * time.Millisecond
+
+// memoryGovernor holds back the start of further programs while the process
+// uses more than -max-memory, so the number of programs running at the same
+// time drops below -concurrency under memory pressure and recovers once the
+// finished programs released their memory. One program is always allowed to
+// run, else the run could never finish.
+type memoryGovernor struct {
+	limit  uint64
+	active atomic.Int64
+
+	mu        sync.Mutex
+	throttled bool
+}
+
+// newMemoryGovernor returns nil for limit 0, the methods of a nil governor
+// never wait. The Go runtime gets the limit as soft limit as well, so it
+// collects garbage harder before the governor has to step in.
+func newMemoryGovernor(limit int64) *memoryGovernor {
+	if limit <= 0 {
+		return nil
+	}
+	debug.SetMemoryLimit(limit)
+	return &memoryGovernor{limit: uint64(limit)}
+}
+
+// memoryUsage is the memory the runtime holds from the OS
+func memoryUsage() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys - m.HeapReleased
+}
+
+// acquire waits until a program may start and counts it as running
+func (g *memoryGovernor) acquire() {
+	if g == nil {
+		return
+	}
+	for g.active.Load() > 0 {
+		usage := memoryUsage()
+		if usage <= g.limit {
+			g.setThrottled(false, usage)
+			break
+		}
+		g.setThrottled(true, usage)
+		time.Sleep(memoryPoll)
+	}
+	g.active.Add(1)
+}
+
+// release marks a program started by acquire as finished
+func (g *memoryGovernor) release() {
+	if g == nil {
+		return
+	}
+	g.active.Add(-1)
+}
+
+// setThrottled logs the changes between throttled and normal dispatch
+func (g *memoryGovernor) setThrottled(throttled bool, usage uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.throttled == throttled {
+		return
+	}
+	g.throttled = throttled
+	if throttled {
+		printWarning("Using %d MB of memory, above -max-memory of %d MB. Holding back further programs with %d running", usage>>20, g.limit>>20, g.active.Load())
+	} else {
+		printInfo("Memory usage below -max-memory again, resuming")
+	}
+}
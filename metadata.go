@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// metadataHeader is the comment line -metadata-header puts on top of every
+// domain and update file of a program. readLines and the line counting skip
+// lines starting with '#', so it never shows up as FQDN or in a diff.
+func metadataHeader(program, platform string) string {
+	return "# program=" + sanitizeName(program) + " platform=" + platform + " generated=" + time.Now().Format("2006-01-02")
+}
+
+// writeMetadataHeaders rewrites every file below dir with header as first
+// line, replacing the header of an earlier run. Compressed history files are
+// left as they are. It returns the number of files that failed.
+func writeMetadataHeaders(dir, header string) int {
+	failed := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isCompressed(path) {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err == nil {
+			err = writeLines(path, append([]string{header}, lines...))
+		}
+		if err != nil {
+			printWarning("Error writing the metadata header of '%s': %v", path, err)
+			failed++
+		}
+		return nil
+	})
+	return failed
+}
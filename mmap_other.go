@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+// mapFile is not implemented on this platform, countLines always streams
+func mapFile(path string) ([]byte, func() error, error) {
+	return nil, nil, errors.New("mmap not supported on this platform")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Output receives the new FQDNs of a run and the history files -additive
+// merges. The filesystem is the default, other sinks like a database or a
+// bucket implement the same methods. They are called from several programs
+// at the same time. Replacing or syncing the history of a program in the
+// other modes moves whole files on disk, the next run diffs against them.
+type Output interface {
+	// WriteNewFQDNs stores the new FQDNs of the domain file relPath of a
+	// program, updateDir is the update directory of the program on disk
+	WriteNewFQDNs(program, platform, updateDir, relPath string, fqdns []string) error
+	// WriteHistoryFile stores the FQDNs -additive merged into the domain file
+	// relPath of a program, domainDir is the history of the program on disk
+	WriteHistoryFile(program, platform, domainDir, relPath string, fqdns []string) error
+	// Finish is called once after the last program with the final statistics
+	Finish(stats *Statistics) error
+}
+
+// output is where copyNewDomains, copyAllDomains and mergeHistory write to
+var output Output = fileOutput{}
+
+// fileOutput writes plain text files with one FQDN per line
+type fileOutput struct{}
+
+func (fileOutput) WriteNewFQDNs(program, platform, updateDir, relPath string, fqdns []string) error {
+	return addUpdates(filepath.Join(updateDir, relPath), fqdns)
+}
+
+func (fileOutput) WriteHistoryFile(program, platform, domainDir, relPath string, fqdns []string) error {
+	return writeLinesMkdir(filepath.Join(domainDir, relPath), fqdns)
+}
+
+func (fileOutput) Finish(stats *Statistics) error {
+	return nil
+}
+
+// writeLinesMkdir is writeLines creating the parent directories of path first
+func writeLinesMkdir(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeLines(path, lines)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// patchFile is written by -patch into the output directory
+func patchFile() string {
+	return "changes_" + time.Now().Format("2006-01-02") + ".patch"
+}
+
+// programPatch returns the changes between the history in oldDir and the
+// extraction in newDir as unified diff that git apply accepts in the output
+// directory. Files whose FQDNs didn't change are left out, the hunks turn the
+// history file as it is on disk into the extracted one. label is the path of
+// the program shown in the file headers.
+func programPatch(newDir, oldDir, label string) string {
+	files := make(map[string]bool)
+	for _, dir := range []string{newDir, oldDir} {
+		filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			relPath, _ := filepath.Rel(dir, path)
+			if dir == oldDir {
+				// A compressed history file is compared as the file it replaced
+				for _, ext := range compressExtensions {
+					relPath = strings.TrimSuffix(relPath, ext)
+				}
+			}
+			if fileMatches(relPath) {
+				files[relPath] = true
+			}
+			return nil
+		})
+	}
+	relPaths := make([]string, 0, len(files))
+	for relPath := range files {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	var b strings.Builder
+	for _, relPath := range relPaths {
+		newPath := filepath.Join(newDir, relPath)
+		newLines, newErr := readLines(newPath)
+		oldPath, exists := findHistoryFile(filepath.Join(oldDir, relPath))
+		var oldLines []string
+		if exists {
+			oldLines, _ = readLines(oldPath)
+		}
+		if len(missingLines(newLines, oldLines)) == 0 && len(missingLines(oldLines, newLines)) == 0 {
+			continue
+		}
+
+		var oldRaw, newRaw []string
+		if exists {
+			oldRaw, _ = readRawLines(oldPath)
+		}
+		if newErr == nil {
+			newRaw, _ = readRawLines(newPath)
+		}
+		name := filepath.ToSlash(filepath.Join(label, relPath))
+		oldName, newName := "a/"+name, "b/"+name
+		if !exists {
+			oldName = "/dev/null"
+		}
+		if newErr != nil {
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		writeHunks(&b, editScript(oldRaw, newRaw))
+	}
+	return b.String()
+}
+
+// readRawLines returns the lines of the decompressed file at path as they
+// are, each with its newline. Only the last line may lack it.
+func readRawLines(path string) ([]string, error) {
+	f, err := openHistoryFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// patchContext is the number of unchanged lines around every change, the
+// default of diff -u
+const patchContext = 3
+
+// maxEditDistance caps the search for the shortest edit script. Files that
+// differ in more lines are written as a single hunk replacing all of them.
+const maxEditDistance = 1000
+
+// editOp is one line of an edit script: ' ' keeps it, '-' removes it from
+// the old file and '+' adds it from the new one
+type editOp struct {
+	kind byte
+	line string
+}
+
+// editScript returns the shortest edit script turning a into b, found with
+// the greedy algorithm of Myers
+func editScript(a, b []string) []editOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []editOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, editOp{' ', line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, editOp{' ', line})
+	}
+	return ops
+}
+
+// myersDiff is editScript without the common prefix and suffix. trace keeps
+// the furthest x of every diagonal k in [-d-1, d+1] before step d.
+func myersDiff(a, b []string) []editOp {
+	n, m := len(a), len(b)
+	v := make([]int, 2*(n+m)+3)
+	offset := n + m + 1
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > maxEditDistance {
+			return replaceAll(a, b)
+		}
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the trace of myersDiff back from the end of both files
+func backtrack(a, b []string, trace [][]int) []editOp {
+	var ops []editOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, editOp{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, editOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, editOp{'-', a[x]})
+		}
+	}
+	slices.Reverse(ops)
+	return ops
+}
+
+// replaceAll is the edit script removing every line of a and adding b
+func replaceAll(a, b []string) []editOp {
+	ops := make([]editOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, editOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, editOp{'+', line})
+	}
+	return ops
+}
+
+// writeHunks writes the changes of ops as hunks with patchContext lines of
+// context, changes closer than twice that share a hunk
+func writeHunks(b *strings.Builder, ops []editOp) {
+	oldLine, newLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := max(0, i-patchContext)
+		end := i
+		for j := i; j < len(ops) && j <= end+2*patchContext+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		end = min(len(ops), end+patchContext+1)
+
+		fmt.Fprintf(b, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[end]-oldLine[start]),
+			hunkRange(newLine[start], newLine[end]-newLine[start]))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+}
+
+// hunkRange formats the lines of one side of a hunk starting after line
+// before. An empty range names the line before it, as diff -u does.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// missingLines returns the lines of a that are not in b
+func missingLines(a, b []string) []string {
+	present := make(map[string]bool, len(b))
+	for _, line := range b {
+		present[line] = true
+	}
+	var missing []string
+	for _, line := range a {
+		if !present[line] {
+			missing = append(missing, line)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProgramPatchHunks(t *testing.T) {
+	setOpts(t, nil)
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(oldDir, "example.com.txt"), "a\nb\nc\nd\ne\nf\ng\nh\n")
+	writeFile(t, filepath.Join(newDir, "example.com.txt"), "a\nb\nc\nx\ne\nf\ng\nh\ni\n")
+
+	want := `--- a/Acme/example.com.txt
++++ b/Acme/example.com.txt
+@@ -1,8 +1,9 @@
+ a
+ b
+ c
+-d
++x
+ e
+ f
+ g
+ h
++i
+`
+	if got := programPatch(newDir, oldDir, "Acme"); got != want {
+		t.Errorf("patch =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestProgramPatchGitApply checks that git apply turns the history into the
+// extraction with the patch, for files that are added, removed, changed in
+// many places, lack the last newline or are compressed
+func TestProgramPatchGitApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	setOpts(t, nil)
+	rng := rand.New(rand.NewSource(1))
+	randomFile := func() string {
+		var lines []string
+		for range 200 {
+			lines = append(lines, fmt.Sprintf("host%d.example.com", rng.Intn(300)))
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+	mutate := func(content string) string {
+		lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+		var kept []string
+		for _, line := range lines {
+			switch rng.Intn(20) {
+			case 0:
+			case 1:
+				kept = append(kept, line, fmt.Sprintf("new%d.example.com", rng.Intn(1000)))
+			default:
+				kept = append(kept, line)
+			}
+		}
+		return strings.Join(kept, "\n") + "\n"
+	}
+
+	outDir := t.TempDir()
+	oldDir := filepath.Join(outDir, "hackerone", "Domains", "Acme")
+	newDir := t.TempDir()
+	files := map[string][2]string{
+		"added.com.txt":      {"", "a.added.com\n"},
+		"removed.com.txt":    {"a.removed.com\nb.removed.com\n", ""},
+		"noeol.com.txt":      {"a.noeol.com\nb.noeol.com", "a.noeol.com\nc.noeol.com"},
+		"header.com.txt":     {"# program=Acme\na.header.com\n", "a.header.com\nb.header.com\n"},
+		"compressed.com.txt": {"a.compressed.com\n", "a.compressed.com\nb.compressed.com\n"},
+	}
+	for i := range 5 {
+		content := randomFile()
+		files[fmt.Sprintf("random%d.com.txt", i)] = [2]string{content, mutate(content)}
+	}
+	for name, content := range files {
+		if content[0] != "" {
+			writeFile(t, filepath.Join(oldDir, name), content[0])
+		}
+		if content[1] != "" {
+			writeFile(t, filepath.Join(newDir, name), content[1])
+		}
+	}
+
+	patch := programPatch(newDir, oldDir, filepath.Join("hackerone", "Domains", "Acme"))
+	// git apply can't patch the compressed file, it gets the plain one
+	compressed := filepath.Join(oldDir, "compressed.com.txt")
+	if err := compressFile(compressed, compressed+".gz", "gzip"); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(compressed)
+	patchGz := programPatch(newDir, oldDir, filepath.Join("hackerone", "Domains", "Acme"))
+	os.Remove(compressed + ".gz")
+	writeFile(t, compressed, files["compressed.com.txt"][0])
+	if patchGz != patch {
+		t.Errorf("compressed history file changed the patch:\n%s", patchGz)
+	}
+
+	if hunks := strings.Count(patch, "\n@@ "); hunks < 20 {
+		t.Errorf("%d hunks, want the random files split into several", hunks)
+	}
+	writeFile(t, filepath.Join(outDir, "changes.patch"), patch)
+	cmd := exec.Command("git", "apply", "changes.patch")
+	cmd.Dir = outDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git apply: %v\n%s\n%s", err, out, patch)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(oldDir, name))
+		if content[1] == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s not removed: %v", name, err)
+			}
+			continue
+		}
+		if string(got) != content[1] {
+			t.Errorf("%s = %q, want %q", name, got, content[1])
+		}
+	}
+}
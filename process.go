@@ -0,0 +1,613 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ProgramResult is everything processing one index entry produced. main
+// aggregates the results into the statistics and the optional reports.
+type ProgramResult struct {
+	Entry           Entry
+	Program         string
+	Platform        string
+	Success         bool
+	Err             error
+	NewFiles        int
+	NewFQDNs        int
+	RemovedFQDNs    int
+	FileCount       int
+	FQDNCount       int
+	BytesDownloaded int64
+	Duration        time.Duration
+
+	downloadDuration time.Duration
+	extractDuration  time.Duration
+	diffDuration     time.Duration
+	// manifestKey is empty if the program has no history
+	manifestKey string
+	manifest    ManifestEntry
+	domainDir   string
+	updateRoot  string
+	// seen are all FQDNs of the feed, only collected for -prune-dead-after
+	seen []string
+	// fqdns are all FQDNs of the program, only collected for -single-file
+	fqdns []string
+	// targets are the new FQDNs, only the resolving ones with -resolve
+	targets          []string
+	duplication      *duplicationStats
+	resolvedFQDNs    int
+	fuzzyDuplicates  int
+	ignoredWildcards int
+	prunedFiles      int
+	empty            bool
+	// patch holds the -patch hunks of the program
+	patch string
+	// newApexes are the registered domains with new FQDNs, only collected
+	// for -report-new-per-apex
+	newApexes []string
+	// aborted is set when the circuit breaker or -min-free-disk gave up on the
+	// whole run
+	aborted bool
+}
+
+// processor holds what the programs of a run share
+type processor struct {
+	budget   *retryBudget
+	breaker  *circuitBreaker
+	archives *archiveCache
+	resolver *resolver
+	// publisher is nil without -publish, hooks without -post-program-cmd
+	publisher Publisher
+	hooks     *hookRunner
+	// ignore is nil without a .chaosignore
+	ignore *chaosIgnore
+	// memory is nil without -max-memory
+	memory *memoryGovernor
+
+	// aborted stops the dispatch of further programs after the run was
+	// aborted, skipped counts the programs never started
+	aborted atomic.Bool
+	skipped atomic.Int64
+
+	// total and started number the programs for -progress-json
+	total   int
+	started atomic.Int64
+}
+
+// entryPlatform is the directory name of the platform of entry
+func entryPlatform(entry Entry) string {
+	platform := sanitizeName(entry.Platform)
+	if platform == "" {
+		platform = sanitizeName(opts.selfhostedName)
+	}
+	return platform
+}
+
+// process downloads the archive of entry, updates its history and collects
+// the updates. Failures are logged here and returned in the result.
+func (p *processor) process(entry Entry) (result ProgramResult) {
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+	index := int(p.started.Add(1))
+	progress := func(phase string) {
+		if !opts.progressJSON {
+			return
+		}
+		event := ProgressEvent{Program: entry.Name, Platform: result.Platform, Index: index, Total: p.total, Phase: phase, NewFQDNs: result.NewFQDNs}
+		if result.Err != nil {
+			event.Error = result.Err.Error()
+		}
+		emitProgress(event)
+	}
+	// Registered before the recover below, so a panic is reported as failed
+	defer func() {
+		switch {
+		case result.Success:
+			progress("done")
+		case result.aborted:
+			progress("aborted")
+		default:
+			progress("failed")
+		}
+	}()
+	// A bug triggered by one bad archive must not take down the whole run
+	defer func() {
+		if r := recover(); r != nil {
+			printError("Recovered from panic while processing '%s': %v\n%s", entry.Name, r, debug.Stack())
+			result.Success = false
+			result.Err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	platform := entryPlatform(entry)
+	name := sanitizeName(entry.Name)
+	result.Entry = entry
+	result.Program = entry.Name
+	result.Platform = platform
+
+	platformDir := platform
+	if opts.splitBounty {
+		platformDir = filepath.Join(bountyDir(entry), platform)
+	}
+
+	domainDir := filepath.Join(platformDir, "Domains", name)
+	tempDir := filepath.Join(os.TempDir(), tempRoot(), platformDir, name)
+
+	setLogProgram(entry.Name, platform)
+	printInfo("Checking for update for '%s' [%s]", entry.Name, entry.Platform)
+	progress("download")
+
+	if opts.resume {
+		// Reaching the end, successful or not, means the download is no longer needed
+		defer os.Remove(resumePath(entry.URL))
+	}
+
+	archive, cached := p.archives.get(entry.URL)
+	var err error
+	replayDir := ""
+	if opts.fromTemp != "" {
+		// The saved extraction stands in for the download and the extraction,
+		// everything after them runs as usual
+		replayDir = filepath.Join(opts.fromTemp, platformDir, name)
+		if info, err := os.Stat(replayDir); err != nil || !info.IsDir() {
+			if err == nil {
+				err = fmt.Errorf("'%s' is not a directory", replayDir)
+			}
+			printError("No saved extraction for '%s' in -from-temp: %v", entry.Name, err)
+			p.archives.release(entry.URL, nil)
+			result.Err = err
+			return result
+		}
+		printInfo("Using the saved extraction in '%s'", replayDir)
+	}
+	if !cached && archive == nil && replayDir == "" && opts.resume {
+		if archive = loadResumed(entry.URL); archive != nil {
+			printInfo("Resuming with the download of an interrupted run")
+			p.archives.put(entry.URL, archive)
+		}
+	}
+	if cached {
+		printInfo("Reusing the archive already downloaded from '%s'", entry.URL)
+	} else if archive == nil && replayDir == "" {
+		downloadStart := time.Now()
+		archive, err = downloadWithRetry(entry.URL, opts.retries, p.budget)
+		if err != nil {
+			printError("Download error: %v", err)
+		}
+		if tripped, trips := p.breaker.record(err != nil); tripped {
+			if trips > opts.breakerMaxTrips {
+				printError("Too many failed downloads, the circuit breaker tripped %d times. Aborting the run", trips)
+				p.archives.release(entry.URL, archive)
+				result.aborted = true
+				return result
+			}
+			printWarning("More than %.0f%% of the last %d downloads failed, pausing for %s", opts.breakerThreshold, opts.breakerWindow, opts.breakerBackoff)
+			time.Sleep(opts.breakerBackoff)
+		}
+		if err != nil {
+			p.archives.release(entry.URL, nil)
+			result.Err = err
+			return result
+		}
+		result.downloadDuration = time.Since(downloadStart)
+		result.BytesDownloaded = archive.Size()
+		if opts.resume {
+			if err := archive.persist(resumePath(entry.URL)); err != nil {
+				printWarning("Error keeping the download for -resume: %v", err)
+			}
+		}
+		p.archives.put(entry.URL, archive)
+	}
+
+	if opts.keepZips != "" && opts.fromTemp == "" {
+		if path, err := keepZip(archive, opts.keepZips, platformDir, name); err != nil {
+			printWarning("Error keeping the archive in '%s': %v", opts.keepZips, err)
+		} else if path != "" {
+			printInfo("Archive saved to '%s'", path)
+		}
+	}
+
+	if opts.stream {
+		fileCount, fqdnCount, counts, err := p.streamZip(archive, entry.Name, platform, os.Stdout)
+		p.archives.release(entry.URL, archive)
+		if err != nil {
+			printError("Stream error: %v", err)
+			result.Err = err
+			return result
+		}
+		if counts.ignored > 0 {
+			printInfo("Skipped %d FQDNs listed in '%s'", counts.ignored, chaosIgnoreFile)
+		}
+		if counts.filtered > 0 {
+			printInfo("Filter command removed %d FQDNs", counts.filtered)
+		}
+		if counts.collapsed > 0 {
+			printInfo("Fuzzy dedupe collapsed %d FQDNs", counts.collapsed)
+			result.fuzzyDuplicates = counts.collapsed
+		}
+		if counts.wildcards > 0 {
+			printInfo("Ignored %d wildcard entries", counts.wildcards)
+			result.ignoredWildcards = counts.wildcards
+		}
+		result.Success = true
+		result.FileCount = fileCount
+		result.FQDNCount = fqdnCount
+		return result
+	}
+
+	if opts.countOnly {
+		fileCount, fqdnCount, err := countZip(archive)
+		p.archives.release(entry.URL, archive)
+		if err != nil {
+			printError("Count error for '%s': %v", entry.Name, err)
+			result.Err = err
+			return result
+		}
+		printInfo("Counted %d FQDNs in %d files", fqdnCount, fileCount)
+		result.Success = true
+		result.FileCount = fileCount
+		result.FQDNCount = fqdnCount
+		return result
+	}
+
+	if opts.minFreeDisk > 0 {
+		if err := waitForDiskSpace(); err != nil {
+			printError("Not enough free disk space, aborting the run before extracting '%s': %v", entry.Name, err)
+			p.archives.release(entry.URL, archive)
+			result.aborted = true
+			return result
+		}
+	}
+
+	// Entries sharing the tree of this program must not extract into the same
+	// temp dir or swap the history at the same time
+	defer dirLocks.lock(domainDir)()
+	if opts.singleFile == "" {
+		os.MkdirAll(filepath.Dir(domainDir), 0755)
+	}
+	// Start from a clean extraction, a kept temp dir of a previous run must not leak into the diff
+	os.RemoveAll(tempDir)
+	os.MkdirAll(tempDir, 0755)
+
+	progress("extract")
+	extractStart := time.Now()
+	var fileCount, fqdnCount int
+	if replayDir != "" {
+		fileCount, fqdnCount, err = replayExtraction(replayDir, tempDir)
+	} else {
+		fileCount, fqdnCount, err = extractZip(archive, tempDir)
+	}
+	p.archives.release(entry.URL, archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.ENOSPC):
+			printError("Disk full while extracting '%s', history was not updated: %v", entry.Name, err)
+		case errors.Is(err, zip.ErrChecksum), errors.Is(err, errCRCMismatch):
+			printError("Corrupt download of '%s', history was not updated: %v", entry.Name, err)
+		default:
+			printError("Extraction error for '%s', history was not updated: %v", entry.Name, err)
+		}
+		if !opts.keepTemp {
+			os.RemoveAll(tempDir)
+		}
+		result.Err = err
+		return result
+	}
+
+	if opts.dedupeReport != "" {
+		lines, unique := countDuplicates(tempDir)
+		result.duplication = &duplicationStats{Program: entry.Name, Platform: platform, Lines: lines, Unique: unique}
+	}
+
+	if opts.outputEncoding != "none" {
+		filepath.WalkDir(tempDir, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if err := normalizeFile(path); err != nil {
+					printWarning("Error normalizing '%s': %v", path, err)
+				}
+			}
+			return nil
+		})
+	}
+
+	if p.ignore != nil {
+		if ignored := p.ignore.filterDir(tempDir); ignored > 0 {
+			printInfo("Skipped %d FQDNs listed in '%s'", ignored, chaosIgnoreFile)
+			fqdnCount -= ignored
+		}
+	}
+	if opts.filterCmd != "" {
+		removed, err := filterDir(tempDir, opts.filterCmd, opts.filterConcurrency)
+		if err != nil {
+			// An unfiltered extraction would put the FQDNs meant to be removed into the history
+			printError("Filter command failed for '%s', history was not updated: %v", entry.Name, err)
+			if !opts.keepTemp {
+				os.RemoveAll(tempDir)
+			}
+			result.Err = err
+			return result
+		}
+		if removed > 0 {
+			printInfo("Filter command removed %d FQDNs", removed)
+		}
+		fqdnCount -= removed
+	}
+	if opts.fuzzyDedupe {
+		if collapsed := fuzzyDedupeDir(tempDir, opts.fuzzyPrefixes); collapsed > 0 {
+			printInfo("Fuzzy dedupe collapsed %d FQDNs", collapsed)
+			result.fuzzyDuplicates = collapsed
+			fqdnCount -= collapsed
+		}
+	}
+	if opts.ignoreWildcards {
+		// Without -keep-wildcard-history they are dropped before the history is
+		// written, otherwise copyNewDomains leaves them out of the updates
+		if dropped := dropWildcardsDir(tempDir, !opts.keepWildcardHistory); dropped > 0 {
+			printInfo("Ignored %d wildcard entries", dropped)
+			result.ignoredWildcards = dropped
+			if !opts.keepWildcardHistory {
+				fqdnCount -= dropped
+			}
+		}
+	}
+	result.extractDuration = time.Since(extractStart)
+
+	if opts.singleFile != "" {
+		// No history and no updates, the FQDNs only end up in the single file
+		result.FileCount, result.FQDNCount = fileCount, fqdnCount
+		result.fqdns = collectFQDNs(tempDir)
+		os.RemoveAll(tempDir)
+		result.Success = true
+		return result
+	}
+
+	date := time.Now().Format("2006-01-02")
+	updateRoot := filepath.Join(platformDir, "Updates"+"_"+date)
+	updateDir := filepath.Join(updateRoot, name)
+	if opts.noUpdatesDir || opts.appendUpdates {
+		updateRoot, updateDir = "", ""
+	}
+
+	progress("diff")
+	diffStart := time.Now()
+	// Programs of the platform write into updateRoot side by side, it is only
+	// removed while none of them is writing
+	unlockUpdates := func() {}
+	if updateRoot != "" {
+		unlockUpdates = sync.OnceFunc(dirLocks.rlock(updateRoot))
+		defer unlockUpdates()
+	}
+	diffDir := updateDir
+	if opts.groupByApex {
+		// Only compute the diff, the update files are written per apex below
+		diffDir = ""
+	}
+	oldDir := domainDir
+	if opts.diffAgainst != "" {
+		// The baseline mirrors the layout of the archive and is only read
+		oldDir = filepath.Join(opts.diffAgainst, domainDir)
+	}
+	var (
+		oldFQDNs int
+		newFiles int
+		newLines []string
+	)
+	var previous map[string][]string
+	if opts.replaceExistingUpdates && updateDir != "" {
+		// Recompute the updates of the day instead of mixing them with the earlier run
+		previous = readUpdateDir(updateDir)
+		os.RemoveAll(updateDir)
+	}
+	if opts.newProgramsFull && entry.IsNew {
+		// Everything of a new program is new by definition, there is nothing to diff against
+		printInfo("New program, taking over all domains without a diff")
+		newFiles, newLines = copyAllDomains(tempDir, diffDir, entry.Name, platform)
+	} else {
+		_, oldFQDNs = countDomainsAndFQDNs(oldDir)
+		newFiles, newLines = copyNewDomains(tempDir, oldDir, diffDir, entry.Name, platform)
+	}
+	if len(previous) > 0 {
+		feed := make(map[string]bool)
+		for _, fqdn := range collectFQDNs(tempDir) {
+			feed[fqdn] = true
+		}
+		carriedFiles, carried := mergePreviousUpdates(previous, feed, updateDir)
+		if len(carried) > 0 {
+			printInfo("Kept %d FQDNs found by an earlier run today", len(carried))
+		}
+		newFiles += carriedFiles
+		newLines = append(newLines, carried...)
+	}
+	newFQDNs := len(newLines)
+	if newFiles > 0 || newFQDNs > 0 {
+		printEvent([]any{"new_files", newFiles, "new_fqdns", newFQDNs},
+			"Found updates: %d new files, %d new FQDNs", newFiles, newFQDNs)
+		for i := 0; i < opts.sampleNew && i < newFQDNs; i++ {
+			printInfo("  + %s", newLines[i])
+		}
+		if opts.sampleNew > 0 && newFQDNs > opts.sampleNew {
+			printInfo("  ... and %d more", newFQDNs-opts.sampleNew)
+		}
+		if opts.hierarchical {
+			reportApexChanges(newLines, oldDir)
+		}
+		if opts.groupByApex && updateDir != "" {
+			if err := writeApexGroups(updateDir, newLines); err != nil {
+				printWarning("Error writing updates to '%s': %v", updateDir, err)
+			}
+		}
+		if opts.emitURLs && updateDir != "" {
+			urlDir(updateDir)
+		}
+		if opts.metadataHeader && updateDir != "" {
+			writeMetadataHeaders(updateDir, metadataHeader(entry.Name, platform))
+		}
+		if opts.appendUpdates {
+			path := filepath.Join(platformDir, "Updates", name, appendFile)
+			if appended, err := appendUpdates(path, date, newLines); err != nil {
+				printWarning("Error appending updates to '%s': %v", path, err)
+			} else if appended > 0 {
+				printInfo("Appended %d FQDNs to '%s'", appended, path)
+			}
+		}
+		if p.publisher != nil {
+			p.publish(newLines, entry.Name, platform)
+		}
+		result.NewFiles = newFiles
+		result.NewFQDNs = newFQDNs
+		result.updateRoot = updateRoot
+		result.targets = newLines
+		if opts.reportNewPerApex {
+			for apex := range groupByApex(newLines) {
+				result.newApexes = append(result.newApexes, apex)
+			}
+		}
+
+		if p.resolver != nil {
+			resolved := p.resolver.resolveAll(newLines)
+			result.resolvedFQDNs = len(resolved)
+			result.targets = resolved
+			printEvent([]any{"new_fqdns", newFQDNs, "resolved_fqdns", len(resolved)},
+				"%d of %d new FQDNs resolve", len(resolved), newFQDNs)
+		}
+	} else if updateDir != "" {
+		// Only empty directories go, an earlier run of the day may have left
+		// updates in them and other programs share the dated directory
+		os.Remove(updateDir)
+		unlockUpdates()
+		unlock := dirLocks.lock(updateRoot)
+		os.Remove(updateRoot)
+		unlock()
+	}
+	unlockUpdates()
+	result.diffDuration = time.Since(diffStart)
+	if opts.patch {
+		result.patch = programPatch(tempDir, oldDir, domainDir)
+	}
+
+	// Counted during the extraction, the transformations above report what they changed
+	result.FileCount, result.FQDNCount = fileCount, fqdnCount
+	// Everything of the old side that is neither kept nor new has gone away,
+	// with -additive it stays in the history though
+	if removed := oldFQDNs + newFQDNs - result.FQDNCount; removed > 0 && !opts.additive {
+		result.RemovedFQDNs = removed
+	}
+
+	if opts.includeEmpty && result.FQDNCount == 0 {
+		// Keep the program in the inventory to tell "no domains" apart from "not processed"
+		printWarning("Program has no domains")
+		os.MkdirAll(domainDir, 0755)
+		result.empty = true
+	}
+
+	// Taken from the extraction, -additive keeps FQDNs in the history that
+	// dropped out of the feed and those have to go stale
+	var feedFQDNs []string
+	if opts.pruneDeadAfter > 0 {
+		feedFQDNs = collectFQDNs(tempDir)
+	}
+
+	switch {
+	case opts.keepTemp:
+		printWarning("Keeping temp files in '%s', history in '%s' was not updated", tempDir, domainDir)
+	case opts.onlyUpdated && newFQDNs == 0:
+		os.RemoveAll(tempDir)
+	case opts.additive:
+		written, err := mergeHistory(tempDir, domainDir, entry.Name, platform)
+		if err != nil {
+			printError("Error merging into the history in '%s': %v", domainDir, err)
+		} else if written > 0 {
+			printInfo("History merged: %d files written", written)
+		}
+	case opts.incrementalHistory:
+		if opts.metadataHeader {
+			// Headers go on the extraction, so only the files that changed get
+			// the header of this run and the others stay untouched. A header
+			// alone must not keep an empty file alive, so those are pruned first.
+			if opts.pruneEmpty {
+				result.prunedFiles = pruneEmpty(tempDir)
+			}
+			writeMetadataHeaders(tempDir, metadataHeader(entry.Name, platform))
+		}
+		written, removed, err := syncHistory(tempDir, domainDir)
+		if err != nil {
+			printError("Error updating history in '%s': %v", domainDir, err)
+		} else if written > 0 || removed > 0 {
+			printInfo("History updated: %d files written, %d files removed", written, removed)
+		}
+	default:
+		os.RemoveAll(domainDir)
+		os.Rename(tempDir, domainDir)
+	}
+
+	if opts.pruneEmpty && !opts.keepTemp {
+		// Only the history of this program was just written, nothing else is touched
+		if pruned := pruneEmpty(domainDir); pruned > 0 {
+			result.prunedFiles += pruned
+		}
+		if result.prunedFiles > 0 {
+			printInfo("Pruned %d empty files", result.prunedFiles)
+		}
+	}
+	// After the pruning, a header alone must not keep an empty file alive
+	if opts.metadataHeader && !opts.keepTemp && !(opts.onlyUpdated && newFQDNs == 0) && !opts.incrementalHistory {
+		writeMetadataHeaders(domainDir, metadataHeader(entry.Name, platform))
+	}
+	if opts.compress && !opts.keepTemp {
+		if _, err := os.Stat(domainDir); err == nil {
+			if err := compressDir(domainDir, opts.compressAlgo); err != nil {
+				printWarning("Error compressing the history in '%s': %v", domainDir, err)
+			}
+		}
+	}
+	if opts.checksums && !opts.keepTemp {
+		if _, err := os.Stat(domainDir); err == nil {
+			if err := writeChecksums(domainDir, opts.hashAlgo); err != nil {
+				printWarning("Error writing checksums of '%s': %v", domainDir, err)
+			}
+		}
+	}
+	if _, err := os.Stat(domainDir); err == nil {
+		result.manifestKey = filepath.ToSlash(filepath.Join(platformDir, name))
+		result.manifest = buildManifestEntry(domainDir)
+		result.domainDir, _ = filepath.Abs(domainDir)
+		result.seen = feedFQDNs
+	}
+	if opts.countHistory && !opts.keepTemp {
+		path := countHistoryPath(platformDir, name)
+		if err := appendCountHistory(path, result.FileCount, result.FQDNCount, newFQDNs); err != nil {
+			printWarning("Error appending to '%s': %v", path, err)
+		}
+	}
+	if p.hooks != nil {
+		if newFQDNs == 0 {
+			// Nothing was written for the program
+			updateDir = ""
+		}
+		p.hooks.run(entry.Name, platform, domainDir, updateDir, newFQDNs)
+	}
+	result.Success = true
+	return result
+}
+
+// publish pushes the new FQDNs of a program to -publish. A failure is only
+// reported, the dump itself goes on.
+func (p *processor) publish(fqdns []string, program, platform string) {
+	now := time.Now()
+	messages := make([]PublishedFQDN, len(fqdns))
+	for i, fqdn := range fqdns {
+		messages[i] = PublishedFQDN{FQDN: fqdn, Program: program, Platform: platform, FoundAt: now}
+	}
+	if err := p.publisher.Publish(messages); err != nil {
+		printWarning("Error publishing %d new FQDNs: %v", len(fqdns), err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProgressEvent is written as one JSON line to stderr with -progress-json
+// whenever a program enters the next phase
+type ProgressEvent struct {
+	Time     time.Time `json:"time"`
+	Program  string    `json:"program"`
+	Platform string    `json:"platform"`
+	Index    int       `json:"index"`
+	Total    int       `json:"total"`
+	Phase    string    `json:"phase"`
+	NewFQDNs int       `json:"new_fqdns"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// progressMu keeps the lines of programs processed in parallel apart
+var progressMu sync.Mutex
+
+// emitProgress writes event to stderr. It doesn't go through the log, so a
+// front-end gets it regardless of -json-logs.
+func emitProgress(event ProgressEvent) {
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	os.Stderr.Write(append(data, '\n'))
+}
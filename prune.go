@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// pruneEmpty removes all zero-byte files below dir and afterwards the
+// directories left empty. dir itself is kept. It returns the number of
+// removed files.
+func pruneEmpty(dir string) int {
+	pruned := 0
+	var dirs []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > 0 {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			printWarning("Error removing empty file '%s': %v", path, err)
+			return nil
+		}
+		pruned++
+		return nil
+	})
+
+	// Deepest first so parents become empty before they are visited
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, d := range dirs {
+		// Fails for directories that still have content, which is fine
+		os.Remove(d)
+	}
+	return pruned
+}
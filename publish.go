@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// publishTimeout bounds connecting to and talking with a -publish backend
+const publishTimeout = 10 * time.Second
+
+// PublishedFQDN is the message sent to -publish for every new FQDN
+type PublishedFQDN struct {
+	FQDN     string    `json:"fqdn"`
+	Program  string    `json:"program"`
+	Platform string    `json:"platform"`
+	FoundAt  time.Time `json:"found_at"`
+}
+
+// Publisher pushes new FQDNs to a message queue as soon as a program is
+// diffed. Implementations must be safe for concurrent use.
+type Publisher interface {
+	Publish(messages []PublishedFQDN) error
+	Close() error
+}
+
+// newPublisher returns the backend selected by the scheme of rawURL
+func newPublisher(rawURL string) (Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "redis":
+		return newRedisPublisher(u)
+	}
+	return nil, fmt.Errorf("unsupported backend '%s', supported are: redis", u.Scheme)
+}
+
+// redisPublisher LPUSHes the messages as JSON onto a list, e.g.
+// redis://:password@localhost:6379/0?key=chaos:new_fqdns
+type redisPublisher struct {
+	mu       sync.Mutex
+	addr     string
+	password string
+	db       int
+	key      string
+	conn     net.Conn
+	r        *bufio.Reader
+}
+
+func newRedisPublisher(u *url.URL) (*redisPublisher, error) {
+	p := &redisPublisher{addr: u.Host, key: u.Query().Get("key")}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if p.key == "" {
+		p.key = "chaos:new_fqdns"
+	}
+	if password, ok := u.User.Password(); ok {
+		p.password = password
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database '%s'", db)
+		}
+		p.db = n
+	}
+	return p, nil
+}
+
+// connect dials the server unless a connection is open. A connection that
+// failed is dropped, so the next Publish starts over.
+func (p *redisPublisher) connect() error {
+	if p.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", p.addr, publishTimeout)
+	if err != nil {
+		return err
+	}
+	p.conn, p.r = conn, bufio.NewReader(conn)
+	if p.password != "" {
+		err = p.command("AUTH", p.password)
+	}
+	if err == nil && p.db != 0 {
+		err = p.command("SELECT", strconv.Itoa(p.db))
+	}
+	if err != nil {
+		p.drop()
+	}
+	return err
+}
+
+func (p *redisPublisher) drop() {
+	p.conn.Close()
+	p.conn, p.r = nil, nil
+}
+
+// command sends args in the RESP protocol and reads the reply
+func (p *redisPublisher) command(args ...string) error {
+	p.conn.SetDeadline(time.Now().Add(publishTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := p.conn.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	reply, err := p.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(reply, "-") {
+		return errors.New(strings.TrimSpace(reply[1:]))
+	}
+	return nil
+}
+
+func (p *redisPublisher) Publish(messages []PublishedFQDN) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	args := []string{"LPUSH", p.key}
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		args = append(args, string(data))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return err
+	}
+	if err := p.command(args...); err != nil {
+		p.drop()
+		return err
+	}
+	return nil
+}
+
+func (p *redisPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.r = nil, nil
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// reportFormats are the values of -report-format
+var reportFormats = map[string]bool{"text": true, "json": true, "csv": true, "markdown": true}
+
+// PlatformStatistics are the totals of the programs of one platform
+type PlatformStatistics struct {
+	Platform          string `json:"platform"`
+	ProcessedPrograms int    `json:"processed_programs"`
+	UpdatedPrograms   int    `json:"updated_programs"`
+	Files             int    `json:"files"`
+	FQDNs             int    `json:"fqdns"`
+	NewFiles          int    `json:"new_files"`
+	NewFQDNs          int    `json:"new_fqdns"`
+}
+
+// printPlatformStatistics prints the per-platform breakdown below the final
+// statistics, it is left out when all programs belong to one platform
+func printPlatformStatistics(platforms []PlatformStatistics) {
+	if len(platforms) < 2 || jsonLogger != nil {
+		return
+	}
+	printStats("%-20s %10s %10s %12s %10s", "Platform", "Programs", "Updated", "FQDNs", "New FQDNs")
+	for _, p := range platforms {
+		printStats("%-20s %10d %10d %12d %10d", p.Platform, p.ProcessedPrograms, p.UpdatedPrograms, p.FQDNs, p.NewFQDNs)
+	}
+}
+
+// writeReportFile writes the final summary in format to path
+func writeReportFile(path, format string, stats *Statistics, platforms []PlatformStatistics) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = writeReport(f, format, stats, platforms)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeReport renders the final summary with the per-platform breakdown as
+// -report-format
+func writeReport(w io.Writer, format string, stats *Statistics, platforms []PlatformStatistics) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Statistics *Statistics          `json:"statistics"`
+			Platforms  []PlatformStatistics `json:"platforms"`
+		}{stats, platforms})
+
+	case "csv":
+		// One row per platform and a final row with the totals of the run
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"platform", "processed_programs", "updated_programs", "files", "fqdns", "new_files", "new_fqdns"})
+		row := func(p PlatformStatistics) {
+			cw.Write([]string{p.Platform,
+				strconv.Itoa(p.ProcessedPrograms), strconv.Itoa(p.UpdatedPrograms),
+				strconv.Itoa(p.Files), strconv.Itoa(p.FQDNs),
+				strconv.Itoa(p.NewFiles), strconv.Itoa(p.NewFQDNs)})
+		}
+		for _, p := range platforms {
+			row(p)
+		}
+		row(PlatformStatistics{"total", stats.ProcessedPrograms, stats.UpdatedPrograms, stats.Files, stats.FQDNs, stats.NewFiles, stats.NewFQDNs})
+		cw.Flush()
+		return cw.Error()
+
+	case "markdown":
+		fmt.Fprintf(w, "| Statistic | Value |\n|---|---:|\n")
+		for _, line := range stats.lines() {
+			if line.show {
+				fmt.Fprintf(w, "| %s | %d |\n", line.label, line.value)
+			}
+		}
+		fmt.Fprintf(w, "| Elapsed | %s |\n", stats.Elapsed.Round(time.Millisecond))
+		if len(platforms) > 0 {
+			fmt.Fprintf(w, "\n| Platform | Programs | Updated | Files | FQDNs | New files | New FQDNs |\n|---|---:|---:|---:|---:|---:|---:|\n")
+			for _, p := range platforms {
+				fmt.Fprintf(w, "| %s | %d | %d | %d | %d | %d | %d |\n", p.Platform, p.ProcessedPrograms, p.UpdatedPrograms, p.Files, p.FQDNs, p.NewFiles, p.NewFQDNs)
+			}
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+
+	for _, line := range stats.lines() {
+		if line.show {
+			fmt.Fprintf(w, "%-32s%d\n", line.label+":", line.value)
+		}
+	}
+	fmt.Fprintf(w, "%-32s%s\n", "Elapsed:", stats.Elapsed.Round(time.Millisecond))
+	if len(platforms) > 0 {
+		fmt.Fprintf(w, "\n%-20s %10s %10s %12s %10s\n", "Platform", "Programs", "Updated", "FQDNs", "New FQDNs")
+		for _, p := range platforms {
+			fmt.Fprintf(w, "%-20s %10d %10d %12d %10d\n", p.Platform, p.ProcessedPrograms, p.UpdatedPrograms, p.FQDNs, p.NewFQDNs)
+		}
+	}
+	return nil
+}
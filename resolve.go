@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolver looks up hostnames with bounded concurrency and remembers every
+// answer for the rest of the run, so hosts shared between programs are only
+// queried once. Each resolveAll runs a fixed pool of workers, sem bounds the
+// lookups of all programs resolving at the same time.
+type resolver struct {
+	timeout time.Duration
+	workers int
+	sem     chan struct{}
+	lookup  func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex
+	cache map[string]*resolveResult
+}
+
+type resolveResult struct {
+	done     chan struct{}
+	resolves bool
+}
+
+func newResolver(concurrency int, timeout time.Duration) *resolver {
+	return &resolver{
+		timeout: timeout,
+		workers: concurrency,
+		sem:     make(chan struct{}, concurrency),
+		lookup:  net.DefaultResolver.LookupHost,
+		cache:   make(map[string]*resolveResult),
+	}
+}
+
+// resolveAll returns the hosts that have at least one DNS record. Wildcard
+// entries can't be resolved and are skipped.
+func (r *resolver) resolveAll(hosts []string) []string {
+	results := make([]bool, len(hosts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(r.workers, len(hosts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = r.resolve(strings.ToLower(strings.TrimSpace(hosts[i])))
+			}
+		}()
+	}
+	for i, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" || strings.HasPrefix(host, "*.") {
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var resolved []string
+	for i, ok := range results {
+		if ok {
+			resolved = append(resolved, hosts[i])
+		}
+	}
+	return resolved
+}
+
+func (r *resolver) resolve(host string) bool {
+	r.mu.Lock()
+	result, cached := r.cache[host]
+	if !cached {
+		result = &resolveResult{done: make(chan struct{})}
+		r.cache[host] = result
+	}
+	r.mu.Unlock()
+
+	if cached {
+		<-result.done
+		return result.resolves
+	}
+
+	r.sem <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	addrs, err := r.lookup(ctx, host)
+	cancel()
+	<-r.sem
+
+	result.resolves = err == nil && len(addrs) > 0
+	close(result.done)
+	return result.resolves
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolveAllWorkerPool(t *testing.T) {
+	r := newResolver(3, time.Second)
+	var mu sync.Mutex
+	inFlight, maxInFlight, lookups := 0, 0, 0
+	goroutines := runtime.NumGoroutine()
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		mu.Lock()
+		inFlight++
+		lookups++
+		maxInFlight = max(maxInFlight, inFlight)
+		// A little slack for goroutines of the runtime, not one per host
+		if n := runtime.NumGoroutine() - goroutines; n > 5 {
+			t.Errorf("%d goroutines resolving, want a pool of 3", n)
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if host == "dead.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"192.0.2.1"}, nil
+	}
+
+	var hosts, want []string
+	for i := range 20 {
+		host := string(rune('a'+i)) + ".example.com"
+		hosts = append(hosts, host)
+		want = append(want, host)
+	}
+	hosts = append(hosts, "*.example.com", "dead.example.com", "A.example.com", "")
+	want = append(want, "A.example.com")
+
+	if got := r.resolveAll(hosts); !slices.Equal(got, want) {
+		t.Errorf("resolveAll = %q, want %q", got, want)
+	}
+	if maxInFlight > 3 {
+		t.Errorf("%d lookups at the same time, want at most 3", maxInFlight)
+	}
+	if lookups != 21 {
+		t.Errorf("%d lookups, want 21 with the cached duplicate left out", lookups)
+	}
+}
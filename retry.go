@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// retryBudget limits the number of download retries across the whole run, so
+// a dead endpoint doesn't multiply the runtime by the per-program retry count
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// take consumes one retry and reports whether the budget allowed it
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// downloadWithRetry calls downloadFile up to retries additional times while
+// the budget lasts, waiting a little longer before each attempt
+func downloadWithRetry(url string, retries int, budget *retryBudget) (*zipArchive, error) {
+	data, err := downloadArchive(url)
+	for attempt := 1; err != nil && attempt <= retries && budget.take(); attempt++ {
+		printWarning("Download failed (%v), retry %d/%d", err, attempt, retries)
+		time.Sleep(time.Duration(attempt) * time.Second)
+		data, err = downloadArchive(url)
+	}
+	return data, err
+}
+
+// downloadArchive is downloadFile, with -retry-on-zip-error a payload that
+// isn't a readable zip (e.g. an error page of the CDN) counts as a failed
+// download as well
+func downloadArchive(url string) (*zipArchive, error) {
+	archive, err := downloadFile(url)
+	if err != nil || !opts.retryOnZipError {
+		return archive, err
+	}
+	if _, err := archive.open(); err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("invalid zip from '%s': %w", url, err)
+	}
+	return archive, nil
+}
+
+// circuitBreaker watches the outcome of the last downloads and trips when the
+// share of failures exceeds the threshold
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  []bool
+	next      int
+	filled    int
+	threshold float64
+	trips     int
+}
+
+func newCircuitBreaker(window int, thresholdPercent float64) *circuitBreaker {
+	return &circuitBreaker{
+		failures:  make([]bool, window),
+		threshold: thresholdPercent / 100,
+	}
+}
+
+// record adds a download outcome and reports whether the breaker tripped
+// together with the number of trips so far. The window is reset after a trip
+// so the next decision is based on fresh results.
+func (b *circuitBreaker) record(failed bool) (bool, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.failures) == 0 {
+		return false, b.trips
+	}
+	b.failures[b.next] = failed
+	b.next = (b.next + 1) % len(b.failures)
+	if b.filled < len(b.failures) {
+		b.filled++
+	}
+	// Decide as soon as the window is full, not one download later
+	if b.filled < len(b.failures) {
+		return false, b.trips
+	}
+
+	failedCount := 0
+	for _, f := range b.failures {
+		if f {
+			failedCount++
+		}
+	}
+	if float64(failedCount)/float64(len(b.failures)) <= b.threshold {
+		return false, b.trips
+	}
+
+	b.trips++
+	b.filled = 0
+	b.next = 0
+	return true, b.trips
+}
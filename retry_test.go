@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryOnZipErrorBadPayloadThenGood(t *testing.T) {
+	setOpts(t, func(o *options) {
+		o.retryOnZipError = true
+		o.retries = 3
+		o.retryBudget = 10
+	})
+	inTempDir(t)
+
+	archive := makeZip(t, map[string]string{"example.com.txt": "a.example.com\n"})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// A CDN error page served with status 200
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Service temporarily unavailable</body></html>"))
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+	p := newTestProcessor([]Entry{entry})
+	result := p.process(entry)
+	if !result.Success || result.Err != nil {
+		t.Fatalf("program failed: %v", result.Err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("%d requests, want 2", got)
+	}
+	if used := 10 - p.budget.remaining; used != 1 {
+		t.Errorf("%d retries used, want 1", used)
+	}
+	if result.FQDNCount != 1 {
+		t.Errorf("FQDN count = %d, want 1", result.FQDNCount)
+	}
+}
+
+func TestCircuitBreakerTripsWhenWindowIsFull(t *testing.T) {
+	const window = 4
+	b := newCircuitBreaker(window, 50)
+	for i := 1; i < window; i++ {
+		if tripped, _ := b.record(true); tripped {
+			t.Fatalf("tripped after %d of %d downloads", i, window)
+		}
+	}
+	if tripped, trips := b.record(true); !tripped || trips != 1 {
+		t.Fatalf("record %d = %v, %d trips, want the breaker to trip", window, tripped, trips)
+	}
+
+	// The window starts over after a trip, half of it failing stays below the threshold
+	for i, failed := range []bool{true, false, true, false} {
+		if tripped, _ := b.record(failed); tripped {
+			t.Fatalf("tripped again after %d downloads at 50%% failures", i+1)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const runInfoFile = "run.json"
+
+// secretFlags are never written to run.json
+var secretFlags = map[string]bool{
+	"index-auth-bearer": true,
+	"index-auth-basic":  true,
+	"webhook":           true,
+	"publish":           true,
+}
+
+// RunInfo makes an Updates_<date> directory self-describing
+type RunInfo struct {
+	Version       string            `json:"version"`
+	FinishedAt    time.Time         `json:"finished_at"`
+	Index         []IndexSource     `json:"index"`
+	NewFQDNs      int               `json:"new_fqdns"`
+	TotalNewFQDNs int               `json:"total_new_fqdns"`
+	Flags         map[string]string `json:"flags"`
+}
+
+// setFlags returns all flags given on the command line, which includes the
+// filters applied, with secrets redacted
+func setFlags() map[string]string {
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if secretFlags[f.Name] {
+			flags[f.Name] = "redacted"
+			return
+		}
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+// writeRunInfo writes run.json into updateRoot. newFQDNs are the new FQDNs
+// in updateRoot, totalNewFQDNs those of the whole run.
+func writeRunInfo(updateRoot string, newFQDNs, totalNewFQDNs int, index []IndexSource) error {
+	info := RunInfo{
+		Version:       version,
+		FinishedAt:    time.Now(),
+		Index:         index,
+		NewFQDNs:      newFQDNs,
+		TotalNewFQDNs: totalNewFQDNs,
+		Flags:         setFlags(),
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(updateRoot, runInfoFile), append(data, '\n'), 0644)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// sanitizePlatformName makes name usable as a single path element. Apart from
+// the separators handled by sanitizeName there are no restrictions here.
+func sanitizePlatformName(name string) string {
+	return name
+}
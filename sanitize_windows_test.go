@@ -0,0 +1,45 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitizePlatformName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"acme", "acme"},
+		{"CON", "_CON"},
+		{"con", "_con"},
+		{"NUL", "_NUL"},
+		{"nul.txt", "_nul.txt"},
+		{"COM1", "_COM1"},
+		{"com1.tar.gz", "_com1.tar.gz"},
+		{"LPT9", "_LPT9"},
+		{"CONSOLE", "CONSOLE"},
+		{"COM10", "COM10"},
+		{"acme.", "acme"},
+		{"acme ", "acme"},
+		{"acme. . ", "acme"},
+		{"CON.", "_CON"},
+		{"a<b>c", "a_b_c"},
+		{`a:b"c`, "a_b_c"},
+		{"a|b?c*", "a_b_c_"},
+		{`<>:"|?*`, "_______"},
+		{"tab\there", "tab_here"},
+	}
+	for _, tc := range tests {
+		if got := sanitizePlatformName(tc.name); got != tc.want {
+			t.Errorf("sanitizePlatformName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeZipPathWindows(t *testing.T) {
+	if got, want := sanitizeZipPath("CON/aux.txt"), filepath.Join("_CON", "_aux.txt"); got != want {
+		t.Errorf("sanitizeZipPath = %q, want %q", got, want)
+	}
+}
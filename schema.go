@@ -0,0 +1,147 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// indexSchemaJSON is the JSON Schema the decoded index is checked against
+// with -validate-index
+//
+//go:embed index.schema.json
+var indexSchemaJSON []byte
+
+// maxSchemaErrors bounds the violations listed for one index
+const maxSchemaErrors = 10
+
+// jsonSchema is the subset of JSON Schema used by index.schema.json
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	MinItems   *int                   `json:"minItems"`
+	Minimum    *float64               `json:"minimum"`
+	Pattern    string                 `json:"pattern"`
+}
+
+// validateIndex checks entries against the embedded schema. Entries are
+// validated as decoded, so the check also applies to -index-field-map. The
+// error lists the first violations with the entry and field they belong to.
+func validateIndex(entries []Entry) error {
+	var schema jsonSchema
+	if err := json.Unmarshal(indexSchemaJSON, &schema); err != nil {
+		return fmt.Errorf("embedded schema: %w", err)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	var violations []string
+	schema.validate(doc, "", func(path, msg string) {
+		violations = append(violations, describePath(path, entries)+": "+msg)
+	})
+	if len(violations) == 0 {
+		return nil
+	}
+	total := len(violations)
+	if total > maxSchemaErrors {
+		violations = append(violations[:maxSchemaErrors], fmt.Sprintf("and %d more", total-maxSchemaErrors))
+	}
+	return fmt.Errorf("%d schema violations: %s", total, strings.Join(violations, "; "))
+}
+
+// validate reports every violation of v against s, path is the JSON Pointer of v
+func (s *jsonSchema) validate(v any, path string, report func(path, msg string)) {
+	if s.Type != "" && !hasSchemaType(v, s.Type) {
+		report(path, "must be of type "+s.Type)
+		return
+	}
+	switch v := v.(type) {
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			report(path, fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s/%d", path, i), report)
+			}
+		}
+	case map[string]any:
+		for _, field := range s.Required {
+			if _, ok := v[field]; !ok {
+				report(path+"/"+field, "is required")
+			}
+		}
+		for _, field := range slices.Sorted(maps.Keys(s.Properties)) {
+			if value, ok := v[field]; ok {
+				s.Properties[field].validate(value, path+"/"+field, report)
+			}
+		}
+	case string:
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				if v == "" {
+					report(path, "must not be empty")
+				} else {
+					report(path, fmt.Sprintf("'%s' does not match %s", v, s.Pattern))
+				}
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			report(path, fmt.Sprintf("must be at least %g", *s.Minimum))
+		}
+	}
+}
+
+func hasSchemaType(v any, typ string) bool {
+	switch typ {
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return true
+}
+
+// describePath names the entry a JSON Pointer like /3/URL points into
+func describePath(path string, entries []Entry) string {
+	if path == "" {
+		return "index"
+	}
+	var i int
+	var field string
+	if n, _ := fmt.Sscanf(path, "/%d/%s", &i, &field); n == 2 && i < len(entries) {
+		if name := strings.TrimSpace(entries[i].Name); name != "" {
+			return fmt.Sprintf("entry %d ('%s') field %s", i+1, name, field)
+		}
+		return fmt.Sprintf("entry %d field %s", i+1, field)
+	}
+	return path
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ScopeRow describes a dumped program for import into trackers and spreadsheets
+type ScopeRow struct {
+	Name       string `json:"name"`
+	Platform   string `json:"platform"`
+	ProgramURL string `json:"program_url"`
+	Bounty     bool   `json:"bounty"`
+	DomainDir  string `json:"domain_dir"`
+}
+
+// writeScope writes rows as JSON if path ends in .json and as CSV otherwise
+func writeScope(path string, rows []ScopeRow) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if rows == nil {
+			rows = []ScopeRow{}
+		}
+		data, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append(data, '\n'), 0644)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"name", "platform", "program_url", "bounty", "domain_dir"})
+	for _, row := range rows {
+		w.Write([]string{row.Name, row.Platform, row.ProgramURL, strconv.FormatBool(row.Bounty), row.DomainDir})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const selectPageSize = 50
+
+// selectEntries lets the user interactively filter and pick the programs to
+// dump. It returns the chosen entries in index order.
+func selectEntries(entries []Entry, in io.Reader) []Entry {
+	selected := make(map[int]bool)
+	filter := ""
+	scanner := bufio.NewScanner(in)
+
+	for {
+		visible := filterEntryIndexes(entries, filter)
+		printSelectList(entries, visible, selected, filter)
+
+		fmt.Fprint(logOutput, colorBold+"select> "+colorReset)
+		if !scanner.Scan() {
+			break
+		}
+		input := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case input == "" || input == "d":
+			return collectSelected(entries, selected)
+		case input == "q":
+			return nil
+		case input == "?":
+			printSelectHelp()
+		case strings.HasPrefix(input, "/"):
+			filter = strings.TrimSpace(input[1:])
+		case input == "a":
+			for _, i := range visible {
+				selected[i] = true
+			}
+		case input == "n":
+			for _, i := range visible {
+				delete(selected, i)
+			}
+		default:
+			if err := toggleSelection(input, visible, selected); err != nil {
+				printWarning("%v (enter ? for help)", err)
+			}
+		}
+	}
+	return collectSelected(entries, selected)
+}
+
+func filterEntryIndexes(entries []Entry, filter string) []int {
+	filter = strings.ToLower(filter)
+	var indexes []int
+	for i, entry := range entries {
+		if filter == "" ||
+			strings.Contains(strings.ToLower(entry.Name), filter) ||
+			strings.Contains(strings.ToLower(entry.Platform), filter) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func printSelectList(entries []Entry, visible []int, selected map[int]bool, filter string) {
+	printSeparator()
+	printHeader("Filter: '%s' | %d matches | %d selected", filter, len(visible), len(selected))
+	for n, i := range visible {
+		if n == selectPageSize {
+			printInfo("... %d more, refine the filter with /text", len(visible)-selectPageSize)
+			break
+		}
+		entry := entries[i]
+		mark := " "
+		if selected[i] {
+			mark = "x"
+		}
+		bounty := ""
+		if entry.Bounty {
+			bounty = "bounty"
+		}
+		fmt.Fprintf(logOutput, "[%s] %4d  %-40s %-12s %8d  %s\n", mark, n+1, entry.Name, entry.Platform, entry.Count, bounty)
+	}
+}
+
+func printSelectHelp() {
+	printInfo("  /text      filter by name or platform (/ alone clears the filter)")
+	printInfo("  1 3 5-9    toggle programs by their number in the list")
+	printInfo("  a / n      select / deselect all matches")
+	printInfo("  d (enter)  done, dump the selected programs")
+	printInfo("  q          quit without dumping anything")
+}
+
+// toggleSelection flips the selection for numbers and ranges like "1 3 5-9",
+// which refer to positions in the currently visible list.
+func toggleSelection(input string, visible []int, selected map[int]bool) error {
+	for _, field := range strings.Fields(strings.ReplaceAll(input, ",", " ")) {
+		from, to, isRange := strings.Cut(field, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return fmt.Errorf("invalid input '%s'", field)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil {
+				return fmt.Errorf("invalid input '%s'", field)
+			}
+		}
+		if start < 1 || end > len(visible) || start > end {
+			return fmt.Errorf("'%s' is out of range 1-%d", field, len(visible))
+		}
+		for n := start; n <= end; n++ {
+			i := visible[n-1]
+			if selected[i] {
+				delete(selected, i)
+			} else {
+				selected[i] = true
+			}
+		}
+	}
+	return nil
+}
+
+func collectSelected(entries []Entry, selected map[int]bool) []Entry {
+	var chosen []Entry
+	for i, entry := range entries {
+		if selected[i] {
+			chosen = append(chosen, entry)
+		}
+	}
+	return chosen
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// programSize is the disk usage of one program directory
+type programSize struct {
+	Dir   string
+	Bytes int64
+	FQDNs int
+}
+
+// programSizes walks all Domains directories below root and sums the file
+// sizes and lines of every program in them
+func programSizes(root string) []programSize {
+	var sizes []programSize
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() && d.Name() == snapshotDir {
+			return filepath.SkipDir
+		}
+		if err != nil || !d.IsDir() || d.Name() != "Domains" {
+			return nil
+		}
+		programs, err := os.ReadDir(path)
+		if err != nil {
+			return filepath.SkipDir
+		}
+		for _, program := range programs {
+			if !program.IsDir() {
+				continue
+			}
+			size := programSize{Dir: filepath.Join(path, program.Name())}
+			filepath.WalkDir(size.Dir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return nil
+				}
+				if info, err := d.Info(); err == nil {
+					size.Bytes += info.Size()
+				}
+				if lines, err := countLines(path); err == nil {
+					size.FQDNs += lines
+				}
+				return nil
+			})
+			sizes = append(sizes, size)
+		}
+		return filepath.SkipDir
+	})
+	return sizes
+}
+
+func printSizeReport(sizes []programSize, n int) {
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].Bytes > sizes[j].Bytes })
+	printHeader("Largest %d programs by size:", min(n, len(sizes)))
+	for i := 0; i < n && i < len(sizes); i++ {
+		printStats("  %-50s %12d bytes", sizes[i].Dir, sizes[i].Bytes)
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].FQDNs > sizes[j].FQDNs })
+	printHeader("Largest %d programs by FQDNs:", min(n, len(sizes)))
+	for i := 0; i < n && i < len(sizes); i++ {
+		printStats("  %-50s %12d FQDNs", sizes[i].Dir, sizes[i].FQDNs)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotDir keeps the dated copies of the history written by -snapshots,
+// each below a directory named by snapshotLayout mirroring the archive root
+const (
+	snapshotDir    = "Snapshots"
+	snapshotLayout = "2006-01-02T150405"
+)
+
+// takeSnapshot copies every Domains tree below root into a new snapshot and
+// removes all but the keep newest snapshots. The files are copied instead of
+// hard linked since -additive and -metadata-header rewrite history files in
+// place.
+func takeSnapshot(root string, keep int) (string, error) {
+	dest := filepath.Join(root, snapshotDir, time.Now().Format(snapshotLayout))
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path != root && (d.Name() == snapshotDir || strings.HasPrefix(d.Name(), updatesPrefix)) {
+			return filepath.SkipDir
+		}
+		if d.Name() != "Domains" {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if err := copyTree(path, filepath.Join(dest, relPath)); err != nil {
+			return err
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		os.RemoveAll(dest)
+		return "", err
+	}
+
+	snapshots, err := listSnapshots(root)
+	if err != nil {
+		return dest, err
+	}
+	for len(snapshots) > keep {
+		if err := os.RemoveAll(snapshots[0].path); err != nil {
+			return dest, err
+		}
+		snapshots = snapshots[1:]
+	}
+	return dest, nil
+}
+
+// copyTree copies the files below src to dst
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyPlainFile(path, target)
+	})
+}
+
+func copyPlainFile(src, dst string) error {
+	acquireFile()
+	defer releaseFile()
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type snapshot struct {
+	path  string
+	taken time.Time
+}
+
+// listSnapshots returns the snapshots below root, oldest first
+func listSnapshots(root string) ([]snapshot, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(root, snapshotDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var snapshots []snapshot
+	for _, d := range dirEntries {
+		taken, err := time.ParseInLocation(snapshotLayout, d.Name(), time.Local)
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		snapshots = append(snapshots, snapshot{filepath.Join(root, snapshotDir, d.Name()), taken})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].taken.Before(snapshots[j].taken) })
+	return snapshots, nil
+}
+
+// findSnapshot returns the newest snapshot taken at least since ago, the
+// baseline of -since
+func findSnapshot(root string, since time.Duration) (snapshot, error) {
+	snapshots, err := listSnapshots(root)
+	if err != nil {
+		return snapshot{}, err
+	}
+	cutoff := time.Now().Add(-since)
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].taken.After(cutoff) {
+			return snapshots[i], nil
+		}
+	}
+	if len(snapshots) == 0 {
+		return snapshot{}, fmt.Errorf("no snapshots in '%s', they are taken with -snapshots", snapshotDir)
+	}
+	return snapshot{}, fmt.Errorf("the oldest snapshot is from %s, less than %s ago", snapshots[0].taken.Format(time.DateTime), since)
+}
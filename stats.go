@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Statistics holds the totals of a run. It is written to -stats-json so the
+// next run can show the change of every metric.
+type Statistics struct {
+	FinishedAt        time.Time     `json:"finished_at"`
+	Elapsed           time.Duration `json:"elapsed_ns"`
+	ProcessedPrograms int           `json:"processed_programs"`
+	UpdatedPrograms   int           `json:"updated_programs"`
+	Files             int           `json:"files"`
+	FQDNs             int           `json:"fqdns"`
+	NewFiles          int           `json:"new_files"`
+	NewFQDNs          int           `json:"new_fqdns"`
+	ResolvedFQDNs     int           `json:"resolved_fqdns"`
+	EmptyPrograms     int           `json:"empty_programs"`
+	FuzzyDuplicates   int           `json:"fuzzy_duplicates"`
+	IgnoredWildcards  int           `json:"ignored_wildcards"`
+	PrunedFiles       int           `json:"pruned_files"`
+	NewApexes         int           `json:"new_apexes"`
+	// TimeLimited marks a run stopped early by -max-runtime
+	TimeLimited     bool `json:"time_limited,omitempty"`
+	SkippedPrograms int  `json:"skipped_programs,omitempty"`
+}
+
+type statLine struct {
+	label string
+	key   string
+	value int
+	show  bool
+}
+
+func (s *Statistics) lines() []statLine {
+	return []statLine{
+		{"Processed programs", "processed_programs", s.ProcessedPrograms, true},
+		{"Programs with updates", "updated_programs", s.UpdatedPrograms, true},
+		{"Second-level domains (files)", "files", s.Files, true},
+		{"Total FQDNs (lines)", "fqdns", s.FQDNs, true},
+		{"New files (updates)", "new_files", s.NewFiles, true},
+		{"New FQDNs (updates)", "new_fqdns", s.NewFQDNs, true},
+		{"Resolving new FQDNs", "resolved_fqdns", s.ResolvedFQDNs, opts.resolve},
+		{"Programs without domains", "empty_programs", s.EmptyPrograms, opts.includeEmpty},
+		{"Fuzzy duplicates collapsed", "fuzzy_duplicates", s.FuzzyDuplicates, opts.fuzzyDedupe},
+		{"Wildcard entries ignored", "ignored_wildcards", s.IgnoredWildcards, opts.ignoreWildcards},
+		{"Empty files pruned", "pruned_files", s.PrunedFiles, opts.pruneEmpty},
+		{"Apexes with new FQDNs", "new_apexes", s.NewApexes, opts.reportNewPerApex},
+	}
+}
+
+// loadStatistics returns the statistics of the previous run or nil if there are none
+func loadStatistics(path string) (*Statistics, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var stats Statistics
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func writeStatistics(path string, stats *Statistics) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// printStatistics prints the final statistics block. With the statistics of
+// the previous run every line also shows the change since then.
+func printStatistics(stats, previous *Statistics) {
+	lines := stats.lines()
+	var previousLines []statLine
+	if previous != nil {
+		previousLines = previous.lines()
+	}
+
+	if jsonLogger != nil {
+		var fields []any
+		for i, line := range lines {
+			fields = append(fields, line.key, line.value)
+			if previousLines != nil {
+				fields = append(fields, line.key+"_change", line.value-previousLines[i].value)
+			}
+		}
+		fields = append(fields, "elapsed", stats.Elapsed.String())
+		logJSON(slog.LevelInfo, "FINAL STATISTICS", fields...)
+		return
+	}
+
+	printSeparator()
+	printHeader("FINAL STATISTICS")
+	printSeparator()
+	for i, line := range lines {
+		if !line.show {
+			continue
+		}
+		change := ""
+		if previousLines != nil {
+			change = fmt.Sprintf(" (%+d since last run)", line.value-previousLines[i].value)
+		}
+		printStats("%-32s%d%s", line.label+":", line.value, change)
+	}
+	printStats("%-32s%s", "Elapsed:", stats.Elapsed.Round(time.Millisecond))
+}
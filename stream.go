@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// streamMu keeps the output of programs processed in parallel apart
+var streamMu sync.Mutex
+
+// streamZip writes a "# program platform" header followed by every FQDN of
+// the archive to w, without touching the disk. The lines of every file go
+// through the same transforms as an extraction, so the counts match a normal
+// run. It returns the number of files and FQDNs streamed.
+func (p *processor) streamZip(archive *zipArchive, program, platform string, w io.Writer) (int, int, transformCounts, error) {
+	var counts transformCounts
+	r, err := archive.open()
+	if err != nil {
+		return 0, 0, counts, err
+	}
+
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	bw.WriteString("# " + program + " " + platform + "\n")
+
+	fileCount, fqdnCount := 0, 0
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fileCount, fqdnCount, counts, fmt.Errorf("opening '%s': %w", f.Name, err)
+		}
+		lines, err := splitLines(rc)
+		rc.Close()
+		if err != nil {
+			return fileCount, fqdnCount, counts, fmt.Errorf("reading '%s': %w", f.Name, err)
+		}
+		fileCount++
+
+		if lines, err = p.transformLines(lines, &counts); err != nil {
+			return fileCount, fqdnCount, counts, fmt.Errorf("filtering '%s': %w", f.Name, err)
+		}
+		for _, line := range lines {
+			if opts.emitURLs {
+				bw.WriteString(toURL(line))
+			} else {
+				bw.WriteString(line)
+			}
+			bw.WriteByte('\n')
+		}
+		fqdnCount += len(lines)
+	}
+	return fileCount, fqdnCount, counts, bw.Flush()
+}
+
+// transformCounts sums up what the transforms of transformLines changed
+type transformCounts struct {
+	ignored   int // removed by .chaosignore
+	filtered  int // removed by the -filter-cmd
+	collapsed int // removed by -fuzzy-dedupe
+	wildcards int // wildcard entries, only removed without -keep-wildcard-history
+}
+
+// transformLines applies the steps process runs on an extracted file to the
+// lines of one file, in the same order. Only the -filter-cmd can fail.
+func (p *processor) transformLines(lines []string, counts *transformCounts) ([]string, error) {
+	lines = normalizeFQDNs(lines)
+	if p.ignore != nil && len(p.ignore.fqdns) > 0 {
+		kept := p.ignore.filter(lines)
+		counts.ignored += len(lines) - len(kept)
+		lines = kept
+	}
+	if opts.filterCmd != "" && len(lines) > 0 {
+		kept, err := filterLines(opts.filterCmd, lines)
+		if err != nil {
+			return nil, err
+		}
+		counts.filtered += len(lines) - len(kept)
+		lines = kept
+	}
+	if opts.fuzzyDedupe {
+		var collapsed int
+		lines, collapsed = fuzzyDedupe(lines, opts.fuzzyPrefixes)
+		counts.collapsed += collapsed
+	}
+	if opts.ignoreWildcards {
+		if opts.keepWildcardHistory {
+			for _, line := range lines {
+				if isWildcard(line) {
+					counts.wildcards++
+				}
+			}
+		} else {
+			var dropped int
+			lines, dropped = dropWildcards(lines)
+			counts.wildcards += dropped
+		}
+	}
+	return lines, nil
+}
+
+// countZip counts the files and FQDNs of the archive for -count-only the same
+// way as extractZip, reading the entries in memory only
+func countZip(archive *zipArchive) (int, int, error) {
+	r, err := archive.open()
+	if err != nil {
+		return 0, 0, fmt.Errorf("opening zip: %w", err)
+	}
+	var counts extractCounts
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		var lc lineCounter
+		_, err = io.Copy(&lc, rc)
+		rc.Close()
+		if err != nil {
+			return counts.files, counts.lines, fmt.Errorf("reading '%s': %w", f.Name, err)
+		}
+		counts.files++
+		counts.lines += lc.count()
+	}
+	return counts.files, counts.lines, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestStreamMatchesExtraction streams an archive and processes it normally
+// with the same transforms, both must yield the same FQDNs and counts
+func TestStreamMatchesExtraction(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(o *options)
+	}{
+		{"plain", nil},
+		{"transforms", func(o *options) {
+			o.outputEncoding = "punycode"
+			o.filterCmd = "grep -v drop"
+			o.fuzzyDedupe = true
+			o.ignoreWildcards = true
+		}},
+		{"wildcard history", func(o *options) {
+			o.ignoreWildcards = true
+			o.keepWildcardHistory = true
+		}},
+	}
+	archive := makeZip(t, map[string]string{
+		"example.com.txt": "# program=acme\r\nwww.example.com\r\nexample.com\r\n  # note\r\napi.example.com\r\n*.dev.example.com\r\n",
+		"bücher.de.txt":   "shop.bücher.de\ndrop.bücher.de\nvpn.internal.bücher.de\n",
+		"other.com.txt":   "#only a comment\n",
+	})
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setOpts(t, tc.change)
+			inTempDir(t)
+			srv := zipServer(t, archive)
+			entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+			p := newTestProcessor([]Entry{entry})
+			p.ignore = &chaosIgnore{fqdns: []string{"*.internal.*"}}
+
+			result := p.process(entry)
+			if !result.Success {
+				t.Fatalf("process failed: %v", result.Err)
+			}
+			history := collectFQDNs(filepath.Join("hackerone", "Domains", "Acme"))
+
+			zipped, err := downloadFile(entry.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zipped.Close()
+			var out bytes.Buffer
+			files, fqdns, counts, err := p.streamZip(zipped, entry.Name, "hackerone", &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamed := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if streamed[0] != "# Acme hackerone" {
+				t.Errorf("header = %q", streamed[0])
+			}
+			streamed = streamed[1:]
+
+			slices.Sort(history)
+			slices.Sort(streamed)
+			if !slices.Equal(streamed, history) {
+				t.Errorf("streamed %q, history %q", streamed, history)
+			}
+			if files != result.FileCount || fqdns != result.FQDNCount {
+				t.Errorf("stream counted %d files %d FQDNs, normal run %d files %d FQDNs", files, fqdns, result.FileCount, result.FQDNCount)
+			}
+			if counts.ignored != 1 {
+				t.Errorf("stream ignored %d FQDNs, want 1", counts.ignored)
+			}
+			if counts.collapsed != result.fuzzyDuplicates || counts.wildcards != result.ignoredWildcards {
+				t.Errorf("stream counts %+v, normal run collapsed %d wildcards %d", counts, result.fuzzyDuplicates, result.ignoredWildcards)
+			}
+		})
+	}
+}
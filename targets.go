@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// writeNucleiTargets writes the deduplicated targets one per line as
+// expected by nuclei -list. Wildcard entries are no scannable hosts and
+// skipped, scheme is prepended if set.
+func writeNucleiTargets(path string, targets map[string]bool, scheme string) (int, error) {
+	hosts := make([]string, 0, len(targets))
+	for host := range targets {
+		if !isWildcard(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	var b strings.Builder
+	for _, host := range hosts {
+		if scheme != "" {
+			b.WriteString(scheme + "://")
+		}
+		b.WriteString(host)
+		b.WriteByte('\n')
+	}
+	return len(hosts), os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// writeSingleFile writes the FQDNs sorted, one per line
+func writeSingleFile(path string, fqdns map[string]bool) error {
+	lines := make([]string, 0, len(fqdns))
+	for fqdn := range fqdns {
+		lines = append(lines, fqdn)
+	}
+	sort.Strings(lines)
+	return writeLines(path, lines)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type downloadTiming struct {
+	Program  string
+	Platform string
+	Bytes    int64
+	Duration time.Duration
+}
+
+// throughput returns the download speed in bytes per second
+func (t downloadTiming) throughput() float64 {
+	if t.Duration <= 0 {
+		return 0
+	}
+	return float64(t.Bytes) / t.Duration.Seconds()
+}
+
+func writeTimingsCSV(path string, timings []downloadTiming) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"program", "platform", "bytes", "duration_ms", "throughput_bytes_per_sec"})
+	for _, t := range timings {
+		w.Write([]string{
+			t.Program,
+			t.Platform,
+			strconv.FormatInt(t.Bytes, 10),
+			strconv.FormatFloat(float64(t.Duration.Microseconds())/1000, 'f', 3, 64),
+			strconv.FormatFloat(t.throughput(), 'f', 0, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func printSlowestDownloads(timings []downloadTiming, n int) {
+	sorted := make([]downloadTiming, len(timings))
+	copy(sorted, timings)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Duration > sorted[j].Duration
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+
+	printHeader("Slowest %d downloads:", len(sorted))
+	for _, t := range sorted {
+		printStats("  %-40s %10s  %10d bytes  %8.1f KB/s", t.Program+" ["+t.Platform+"]", t.Duration.Round(time.Millisecond), t.Bytes, t.throughput()/1024)
+	}
+}
+
+// phaseTimings sums up where the time of a run went
+type phaseTimings struct {
+	Download time.Duration
+	Extract  time.Duration
+	Diff     time.Duration
+}
+
+func printPhaseTimings(phases phaseTimings) {
+	printHeader("Time per phase:")
+	printStats("  %-12s %10s", "Download", phases.Download.Round(time.Millisecond))
+	printStats("  %-12s %10s", "Extract", phases.Extract.Round(time.Millisecond))
+	printStats("  %-12s %10s", "Diff", phases.Diff.Round(time.Millisecond))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const updatesPrefix = "Updates_"
+
+type updateRunSummary struct {
+	Date     string
+	Programs map[string]bool
+	NewFQDNs int
+}
+
+// listUpdates prints a timeline of all Updates_<date> directories and
+// archives below root, grouped by date across platforms. They are found at
+// any depth, so layouts like -split-bounty are covered as well.
+func listUpdates(root string) error {
+	runs := make(map[string]*updateRunSummary)
+	run := func(date string) *updateRunSummary {
+		if runs[date] == nil {
+			runs[date] = &updateRunSummary{Date: date, Programs: make(map[string]bool)}
+		}
+		return runs[date]
+	}
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			printWarning("Error reading '%s': %v", path, err)
+			return nil
+		}
+		if d.IsDir() && d.Name() == "Domains" {
+			return filepath.SkipDir
+		}
+		date, ok := parseUpdateDate(d.Name())
+		if !ok {
+			return nil
+		}
+
+		platform, _ := filepath.Rel(root, filepath.Dir(path))
+		platform = filepath.ToSlash(platform)
+		if d.IsDir() {
+			err = summarizeUpdateDir(path, platform, run(date))
+		} else {
+			err = summarizeUpdateZip(path, platform, run(date))
+		}
+		if err != nil {
+			printWarning("Error reading '%s': %v", path, err)
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dates := make([]string, 0, len(runs))
+	for date := range runs {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	printHeader("%-12s %10s %12s", "Date", "Programs", "New FQDNs")
+	printSeparator()
+	for _, date := range dates {
+		printStats("%-12s %10d %12d", date, len(runs[date].Programs), runs[date].NewFQDNs)
+	}
+	return nil
+}
+
+// parseUpdateDate extracts the date of an Updates_<date> directory or Updates_<date>.zip archive
+func parseUpdateDate(name string) (string, bool) {
+	if !strings.HasPrefix(name, updatesPrefix) {
+		return "", false
+	}
+	date := strings.TrimSuffix(strings.TrimPrefix(name, updatesPrefix), ".zip")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", false
+	}
+	return date, true
+}
+
+func summarizeUpdateDir(dir, platform string, summary *updateRunSummary) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relPath, _ := filepath.Rel(dir, path)
+		program := strings.Split(filepath.ToSlash(relPath), "/")[0]
+		summary.Programs[platform+"/"+program] = true
+
+		lines, err := countLines(path)
+		summary.NewFQDNs += lines
+		return err
+	})
+}
+
+func summarizeUpdateZip(path, platform string, summary *updateRunSummary) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		program := strings.Split(f.Name, "/")[0]
+		summary.Programs[platform+"/"+program] = true
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		lines, err := countReaderLines(rc)
+		rc.Close()
+		summary.NewFQDNs += lines
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addUpdates writes fqdns to the update file path. A rerun on the same day
+// adds to the file of the earlier run instead of replacing it, FQDNs already
+// in it are not added again.
+func addUpdates(path string, fqdns []string) error {
+	current, err := readLines(path)
+	if err != nil || len(current) == 0 {
+		return writeLinesMkdir(path, fqdns)
+	}
+	present := make(map[string]bool, len(current))
+	for _, line := range current {
+		if opts.emitURLs {
+			line = stripURL(line)
+		}
+		present[line] = true
+	}
+	merged := current
+	for _, fqdn := range fqdns {
+		if !present[fqdn] {
+			present[fqdn] = true
+			merged = append(merged, fqdn)
+		}
+	}
+	return writeLines(path, merged)
+}
+
+// readUpdateDir returns the lines of every file below dir by relative path
+func readUpdateDir(dir string) map[string][]string {
+	files := make(map[string][]string)
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if lines, err := readLines(path); err == nil {
+			if opts.emitURLs {
+				for i, line := range lines {
+					lines[i] = stripURL(line)
+				}
+			}
+			relPath, _ := filepath.Rel(dir, path)
+			files[relPath] = lines
+		}
+		return nil
+	})
+	return files
+}
+
+// mergePreviousUpdates carries the updates of an earlier run of the same day
+// into updateDir. The history already contains them, so the rerun can't find
+// them again; those still in the feed are new relative to the history before
+// the first run of the day. It returns the number of files that only the
+// earlier run had and the carried FQDNs.
+func mergePreviousUpdates(previous map[string][]string, feed map[string]bool, updateDir string) (int, []string) {
+	newFiles := 0
+	var merged []string
+	for relPath, lines := range previous {
+		path := filepath.Join(updateDir, relPath)
+		current, err := readLines(path)
+		if err != nil {
+			current = nil
+		}
+		present := make(map[string]bool, len(current))
+		for _, line := range current {
+			present[line] = true
+		}
+
+		var carried []string
+		for _, line := range lines {
+			if feed[line] && !present[line] {
+				carried = append(carried, line)
+				present[line] = true
+			}
+		}
+		if len(carried) == 0 {
+			continue
+		}
+		if current == nil {
+			newFiles++
+		}
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := writeLines(path, append(current, carried...)); err != nil {
+			printWarning("Error writing '%s': %v", path, err)
+			continue
+		}
+		merged = append(merged, carried...)
+	}
+	return newFiles, merged
+}
+
+// appendFile is the per-program file of -append-updates below
+// <platform>/Updates/<program>
+const appendFile = "new_fqdns.txt"
+
+// appendUpdates appends the FQDNs not yet in the file at path below a
+// "# <date>" marker and returns how many were appended
+func appendUpdates(path, date string, fqdns []string) (int, error) {
+	present := make(map[string]bool)
+	if lines, err := readLines(path); err == nil {
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "#") {
+				present[line] = true
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	var b strings.Builder
+	appended := 0
+	for _, fqdn := range fqdns {
+		if present[fqdn] {
+			continue
+		}
+		present[fqdn] = true
+		if appended == 0 {
+			b.WriteString("# " + date + "\n")
+		}
+		b.WriteString(fqdn + "\n")
+		appended++
+	}
+	if appended == 0 {
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.WriteString(b.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return appended, err
+}
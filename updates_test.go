@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestProcessRerunKeepsUpdates runs a program twice on the same day, the
+// second run finds nothing new and must keep the updates of the first
+func TestProcessRerunKeepsUpdates(t *testing.T) {
+	setOpts(t, nil)
+	inTempDir(t)
+	writeFile(t, filepath.Join("hackerone", "Domains", "Acme", "example.com.txt"), "a.example.com\n")
+	srv := zipServer(t, makeZip(t, map[string]string{"example.com.txt": "a.example.com\nb.example.com\n"}))
+	entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+	update := filepath.Join("hackerone", updatesPrefix+time.Now().Format("2006-01-02"), "Acme", "example.com.txt")
+
+	for run := 1; run <= 2; run++ {
+		result := newTestProcessor([]Entry{entry}).process(entry)
+		if !result.Success {
+			t.Fatalf("run %d failed: %v", run, result.Err)
+		}
+		got, err := os.ReadFile(update)
+		if err != nil || string(got) != "b.example.com\n" {
+			t.Errorf("run %d: update file = %q, %v, want the update of the first run", run, got, err)
+		}
+	}
+}
+
+// TestProcessRerunAddsUpdates runs a program twice on the same day with a new
+// FQDN in the second feed, the update file must hold the updates of both runs
+func TestProcessRerunAddsUpdates(t *testing.T) {
+	for name, emitURLs := range map[string]bool{"hosts": false, "urls": true} {
+		t.Run(name, func(t *testing.T) {
+			setOpts(t, func(o *options) { o.emitURLs = emitURLs })
+			inTempDir(t)
+			writeFile(t, filepath.Join("hackerone", "Domains", "Acme", "example.com.txt"), "a.example.com\n")
+			update := filepath.Join("hackerone", updatesPrefix+time.Now().Format("2006-01-02"), "Acme", "example.com.txt")
+
+			for _, feed := range []string{"a.example.com\nb.example.com\n", "a.example.com\nb.example.com\nc.example.com\n"} {
+				srv := zipServer(t, makeZip(t, map[string]string{"example.com.txt": feed}))
+				entry := Entry{Name: "Acme", URL: srv.URL + "/acme.zip", Platform: "hackerone"}
+				if result := newTestProcessor([]Entry{entry}).process(entry); !result.Success {
+					t.Fatalf("run failed: %v", result.Err)
+				}
+			}
+
+			want := "b.example.com\nc.example.com\n"
+			if emitURLs {
+				want = "https://b.example.com\nhttps://c.example.com\n"
+			}
+			if got, err := os.ReadFile(update); err != nil || string(got) != want {
+				t.Errorf("update file = %q, %v, want %q", got, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// toURL turns fqdn into a URL for -emit-urls. Wildcard entries are no
+// reachable hosts and stay as they are, so do lines that already are URLs,
+// e.g. those an earlier run of the day left in the update file.
+func toURL(fqdn string) string {
+	if isWildcard(fqdn) || strings.HasPrefix(fqdn, opts.urlScheme+"://") {
+		return fqdn
+	}
+	return opts.urlScheme + "://" + fqdn + opts.urlPath
+}
+
+// stripURL reverts toURL, lines that are no URL are returned unchanged
+func stripURL(line string) string {
+	host, ok := strings.CutPrefix(line, opts.urlScheme+"://")
+	if !ok {
+		return line
+	}
+	return strings.TrimSuffix(host, opts.urlPath)
+}
+
+// urlDir rewrites every file below dir to URLs
+func urlDir(dir string) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		for i, line := range lines {
+			lines[i] = toURL(line)
+		}
+		if err := writeLines(path, lines); err != nil {
+			printWarning("Error writing '%s': %v", path, err)
+		}
+		return nil
+	})
+}
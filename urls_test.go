@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestURLDirRerun converts an update file twice, like two runs on the same
+// day, the URLs of the first run must not get a second scheme
+func TestURLDirRerun(t *testing.T) {
+	setOpts(t, func(o *options) {
+		o.emitURLs = true
+		o.urlPath = "/robots.txt"
+	})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.com.txt")
+	writeFile(t, path, "a.example.com\n*.example.com\n")
+	urlDir(dir)
+	lines, _ := readLines(path)
+	writeLines(path, append(lines, "b.example.com"))
+	urlDir(dir)
+
+	lines, err := readLines(path)
+	want := []string{"https://a.example.com/robots.txt", "*.example.com", "https://b.example.com/robots.txt"}
+	if err != nil || !slices.Equal(lines, want) {
+		t.Errorf("update file = %q, %v, want %q", lines, err, want)
+	}
+	hosts := []string{"a.example.com", "*.example.com", "b.example.com"}
+	for i, line := range lines {
+		if got := stripURL(line); got != hosts[i] {
+			t.Errorf("stripURL(%q) = %q, want %q", line, got, hosts[i])
+		}
+	}
+}
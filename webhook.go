@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSummary is posted as JSON to -webhook after a run
+type WebhookSummary struct {
+	Version    string          `json:"version"`
+	FinishedAt time.Time       `json:"finished_at"`
+	IndexError string          `json:"index_error,omitempty"`
+	Failed     []FailedProgram `json:"failed"`
+	Statistics *Statistics     `json:"statistics,omitempty"`
+}
+
+func (s *WebhookSummary) hasErrors() bool {
+	return s.IndexError != "" || len(s.Failed) > 0
+}
+
+// notifyWebhook posts summary to -webhook. With -summary-webhook-on-error
+// runs without failures are not reported.
+func notifyWebhook(summary *WebhookSummary) {
+	if opts.webhook == "" || (opts.webhookOnError && !summary.hasErrors()) {
+		return
+	}
+	if summary.Failed == nil {
+		summary.Failed = []FailedProgram{}
+	}
+	if err := postJSON(opts.webhook, summary); err != nil {
+		printError("Error sending the webhook: %v", err)
+		return
+	}
+	printSuccess("Run summary sent to the webhook")
+}
+
+func postJSON(url string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
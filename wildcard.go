@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func isWildcard(line string) bool {
+	return strings.HasPrefix(line, "*.")
+}
+
+// dropWildcards returns lines without wildcard entries and the number of dropped ones
+func dropWildcards(lines []string) ([]string, int) {
+	kept := lines[:0]
+	dropped := 0
+	for _, line := range lines {
+		if isWildcard(line) {
+			dropped++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept, dropped
+}
+
+// dropWildcardsDir counts the wildcard entries of every file below dir and
+// with rewrite set also removes them from the files
+func dropWildcardsDir(dir string, rewrite bool) int {
+	total := 0
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			return nil
+		}
+		kept, dropped := dropWildcards(lines)
+		if dropped == 0 {
+			return nil
+		}
+		if rewrite {
+			if err := writeLines(path, kept); err != nil {
+				printWarning("Error writing '%s': %v", path, err)
+				return nil
+			}
+		}
+		total += dropped
+		return nil
+	})
+	return total
+}
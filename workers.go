@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parsePlatformConcurrency parses -platform-concurrency, e.g. "hackerone=2,bugcrowd=8"
+func parsePlatformConcurrency(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		platform, limit, ok := strings.Cut(part, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid limit '%s', expected platform=N with N > 0", part)
+		}
+		limits[strings.ToLower(sanitizeName(strings.TrimSpace(platform)))] = n
+	}
+	return limits, nil
+}
+
+// run processes entries with up to opts.concurrency programs at a time and
+// sends every result on the returned channel, which is closed once all are
+// done. Platforms with a -platform-concurrency limit are dispatched in their
+// own lane so a throttled platform never holds up the others, within a lane
+// the order of entries is kept. No new programs are started after the
+// deadline passed or the run was aborted. With -max-memory fewer programs
+// run at the same time while the memory usage is above the limit.
+func (p *processor) run(entries []Entry, deadline time.Time) <-chan ProgramResult {
+	results := make(chan ProgramResult)
+	global := make(chan struct{}, opts.concurrency)
+
+	lanes := map[string][]Entry{}
+	var laneOrder []string
+	for _, entry := range entries {
+		lane := strings.ToLower(entryPlatform(entry))
+		if opts.platformConcurrency[lane] == 0 {
+			lane = ""
+		}
+		if _, ok := lanes[lane]; !ok {
+			laneOrder = append(laneOrder, lane)
+		}
+		lanes[lane] = append(lanes[lane], entry)
+	}
+
+	var wg sync.WaitGroup
+	var deadlineOnce sync.Once
+	for _, lane := range laneOrder {
+		var laneSem chan struct{}
+		if lane != "" {
+			laneSem = make(chan struct{}, opts.platformConcurrency[lane])
+		}
+		wg.Add(1)
+		go func(laneEntries []Entry) {
+			defer wg.Done()
+			for i, entry := range laneEntries {
+				if laneSem != nil {
+					laneSem <- struct{}{}
+				}
+				global <- struct{}{}
+				p.memory.acquire()
+				release := func() {
+					p.memory.release()
+					<-global
+					if laneSem != nil {
+						<-laneSem
+					}
+				}
+
+				expired := !deadline.IsZero() && time.Now().After(deadline)
+				if expired {
+					deadlineOnce.Do(func() {
+						printWarning("Reached -max-runtime of %s, no further programs are started", opts.maxRuntime)
+					})
+				}
+				if expired || p.aborted.Load() {
+					release()
+					p.skipped.Add(int64(len(laneEntries) - i))
+					return
+				}
+
+				wg.Add(1)
+				go func(entry Entry) {
+					defer wg.Done()
+					defer release()
+					result := p.process(entry)
+					if result.aborted {
+						p.aborted.Store(true)
+					}
+					results <- result
+				}(entry)
+			}
+		}(lanes[lane])
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// sortEntries orders entries for -sort, ties are broken by platform and name
+// so the dispatch order is the same on every run
+func sortEntries(entries []Entry, by string) {
+	byPlatform := func(a, b Entry) int {
+		if c := strings.Compare(strings.ToLower(entryPlatform(a)), strings.ToLower(entryPlatform(b))); c != 0 {
+			return c
+		}
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	}
+	switch by {
+	case "platform":
+		slices.SortStableFunc(entries, byPlatform)
+	case "name":
+		slices.SortStableFunc(entries, func(a, b Entry) int {
+			if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+				return c
+			}
+			return byPlatform(a, b)
+		})
+	case "count":
+		// Largest programs first, they take longest
+		slices.SortStableFunc(entries, func(a, b Entry) int {
+			if c := cmp.Compare(b.Count, a.Count); c != 0 {
+				return c
+			}
+			return byPlatform(a, b)
+		})
+	}
+}
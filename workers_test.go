@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunConcurrentSharedDirectories(t *testing.T) {
+	setOpts(t, func(o *options) { o.concurrency = 16 })
+	inTempDir(t)
+
+	// /dup/N serves a different archive for every duplicate of one program,
+	// /prog/N the archive of a distinct program
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := filepath.Base(r.URL.Path)
+		content := fmt.Sprintf("shared.example.com\nhost%s.example.com\n", id)
+		w.Write(makeZip(t, map[string]string{"example.com.txt": content}))
+	}))
+	t.Cleanup(srv.Close)
+
+	const n = 24
+	var entries []Entry
+	for i := 0; i < n; i++ {
+		// The same name maps every duplicate to hackerone/Domains/Acme
+		entries = append(entries,
+			Entry{Name: "Acme", URL: fmt.Sprintf("%s/dup/%d", srv.URL, i), Platform: "hackerone"},
+			Entry{Name: fmt.Sprintf("New %d", i), URL: fmt.Sprintf("%s/prog/%d", srv.URL, i), Platform: "hackerone"},
+			Entry{Name: fmt.Sprintf("Stable %d", i), URL: fmt.Sprintf("%s/stable/%d", srv.URL, i), Platform: "hackerone"},
+		)
+		// Stable programs already have everything, they remove their empty
+		// update directory and try to remove the shared Updates_<date>
+		writeFile(t, filepath.Join("hackerone", "Domains", fmt.Sprintf("Stable_%d", i), "example.com.txt"),
+			fmt.Sprintf("shared.example.com\nhost%d.example.com\n", i))
+	}
+
+	p := newTestProcessor(entries)
+	for result := range p.run(entries, time.Time{}) {
+		if result.Err != nil || !result.Success {
+			t.Errorf("%s failed: %v", result.Program, result.Err)
+		}
+	}
+
+	acme, err := readLines(filepath.Join("hackerone", "Domains", "Acme", "example.com.txt"))
+	if err != nil || len(acme) != 2 || acme[0] != "shared.example.com" || !strings.HasPrefix(acme[1], "host") {
+		t.Errorf("history of the duplicates is mixed up: %q, %v", acme, err)
+	}
+	updateRoot := filepath.Join("hackerone", updatesPrefix+time.Now().Format("2006-01-02"))
+	for i := 0; i < n; i++ {
+		lines, err := readLines(filepath.Join(updateRoot, fmt.Sprintf("New_%d", i), "example.com.txt"))
+		if err != nil || len(lines) != 2 {
+			t.Errorf("updates of New %d: %q, %v", i, lines, err)
+		}
+		if _, err := os.Stat(filepath.Join(updateRoot, fmt.Sprintf("Stable_%d", i))); !os.IsNotExist(err) {
+			t.Errorf("Stable %d has an update directory", i)
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(os.TempDir(), tempRoot(), "hackerone", "*")); len(leftovers) > 0 {
+		t.Errorf("temp dirs left behind: %v", leftovers)
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	setOpts(t, nil)
+	// In index order, ties on the sort key and differing case on purpose
+	index := []Entry{
+		{Name: "beta", Platform: "intigriti", Count: 10},
+		{Name: "Alpha", Platform: "hackerone", Count: 5},
+		{Name: "alpha", Platform: "bugcrowd", Count: 10},
+		{Name: "gamma", Platform: "", Count: 5},
+		{Name: "Beta", Platform: "HackerOne", Count: 20},
+		{Name: "delta", Platform: "hackerone", Count: 5},
+	}
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		// "selfhosted" is the platform of entries without one
+		{"platform", []string{"bugcrowd/alpha", "hackerone/Alpha", "HackerOne/Beta", "hackerone/delta", "intigriti/beta", "/gamma"}},
+		// Equal names go by platform
+		{"name", []string{"bugcrowd/alpha", "hackerone/Alpha", "HackerOne/Beta", "intigriti/beta", "hackerone/delta", "/gamma"}},
+		// Equal counts go by platform and name
+		{"count", []string{"HackerOne/Beta", "bugcrowd/alpha", "intigriti/beta", "hackerone/Alpha", "hackerone/delta", "/gamma"}},
+		{"index", []string{"intigriti/beta", "hackerone/Alpha", "bugcrowd/alpha", "/gamma", "HackerOne/Beta", "hackerone/delta"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.by, func(t *testing.T) {
+			entries := slices.Clone(index)
+			sortEntries(entries, tc.by)
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Platform+"/"+entry.Name)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("sortEntries(%s) = %q, want %q", tc.by, got, tc.want)
+			}
+		})
+	}
+}